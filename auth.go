@@ -0,0 +1,345 @@
+package vortex
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// redacted replaces credentials in generated curl commands.
+const redacted = "[REDACTED]"
+
+// SetBasicAuth sends the username and password with every request using
+// HTTP Basic authentication.
+func (c *Client) SetBasicAuth(username, password string) *Client {
+	c.headers.Set("Authorization", basicAuth(username, password))
+	return c
+}
+
+func (r *Request) SetBasicAuth(username, password string) *Request {
+	r.header().Set("Authorization", basicAuth(username, password))
+	return r
+}
+
+// SetBearerToken sends token in a Bearer Authorization header.
+func (c *Client) SetBearerToken(token string) *Client {
+	c.headers.Set("Authorization", "Bearer "+token)
+	return c
+}
+
+func (r *Request) SetBearerToken(token string) *Request {
+	r.header().Set("Authorization", "Bearer "+token)
+	return r
+}
+
+// SetDigestAuth answers HTTP Digest challenges with the username and
+// password. A request that gets a 401 with a Digest challenge is sent again
+// with the computed credentials, and later requests reuse the challenge
+// with an incremented nonce count. MD5, SHA-256 and their -sess variants
+// are supported, with qop auth or auth-int.
+func (c *Client) SetDigestAuth(username, password string) *Client {
+	c.digest = &digestAuth{username: username, password: password}
+	return c
+}
+
+func (r *Request) SetDigestAuth(username, password string) *Request {
+	r.digest = &digestAuth{username: username, password: password}
+	return r
+}
+
+// ShowCurlSecrets makes GenerateCurlCommand print credentials instead of
+// redacting them.
+func (c *Client) ShowCurlSecrets() *Client {
+	c.showSecrets = true
+	return c
+}
+
+func (r *Request) ShowCurlSecrets() *Request {
+	r.showSecrets = true
+	return r
+}
+
+func basicAuth(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
+
+// isSecretHeader reports whether the header carries credentials that are
+// redacted from curl commands.
+func isSecretHeader(key string) bool {
+	key = http.CanonicalHeaderKey(key)
+	return key == "Authorization" || key == "Proxy-Authorization"
+}
+
+// redactCredentials keeps the scheme of an Authorization value and hides
+// the rest.
+func redactCredentials(value string) string {
+	if scheme, _, ok := strings.Cut(value, " "); ok {
+		return scheme + " " + redacted
+	}
+	return redacted
+}
+
+// digestAuth holds the Digest credentials and the last challenge, shared by
+// all requests of a client.
+type digestAuth struct {
+	username string
+	password string
+
+	mu        sync.Mutex
+	challenge *digestChallenge
+	nc        uint32
+}
+
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	stale     bool
+}
+
+// digestTransport authenticates requests against Digest challenges.
+type digestTransport struct {
+	next http.RoundTripper
+	auth *digestAuth
+}
+
+func (t *digestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	sent := false
+	if authorization, ok, err := t.auth.authorize(req); err != nil {
+		return nil, err
+	} else if ok {
+		req = withHeader(req, "Authorization", authorization)
+		sent = true
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge, ok := parseDigestChallenge(resp.Header.Values("WWW-Authenticate"))
+	if !ok || sent && !challenge.stale {
+		return resp, nil
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	t.auth.setChallenge(challenge)
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		retry.Body = body
+	}
+	authorization, _, err := t.auth.authorize(retry)
+	if err != nil {
+		return nil, err
+	}
+	retry.Header.Set("Authorization", authorization)
+	return t.next.RoundTrip(retry)
+}
+
+func withHeader(req *http.Request, key, value string) *http.Request {
+	clone := req.Clone(req.Context())
+	clone.Body = req.Body
+	clone.Header.Set(key, value)
+	return clone
+}
+
+func (a *digestAuth) setChallenge(challenge *digestChallenge) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.challenge = challenge
+	a.nc = 0
+}
+
+// authorize computes the Authorization header for req from the last
+// challenge. It reports false when no challenge has been seen yet.
+func (a *digestAuth) authorize(req *http.Request) (string, bool, error) {
+	a.mu.Lock()
+	challenge := a.challenge
+	if challenge == nil {
+		a.mu.Unlock()
+		return "", false, nil
+	}
+	a.nc++
+	nc := fmt.Sprintf("%08x", a.nc)
+	a.mu.Unlock()
+
+	newHash := sha256.New
+	if strings.HasPrefix(strings.ToUpper(challenge.algorithm), "MD5") {
+		newHash = md5.New
+	}
+	h := func(s string) string {
+		return hashHex(newHash(), s)
+	}
+
+	cnonce, err := newCnonce()
+	if err != nil {
+		return "", false, err
+	}
+	uri := req.URL.RequestURI()
+
+	ha1 := h(a.username + ":" + challenge.realm + ":" + a.password)
+	if strings.HasSuffix(strings.ToLower(challenge.algorithm), "-sess") {
+		ha1 = h(ha1 + ":" + challenge.nonce + ":" + cnonce)
+	}
+	ha2 := h(req.Method + ":" + uri)
+	if challenge.qop == "auth-int" {
+		body, err := readRequestBody(req)
+		if err != nil {
+			return "", false, err
+		}
+		ha2 = h(req.Method + ":" + uri + ":" + h(string(body)))
+	}
+
+	var response string
+	if challenge.qop == "" {
+		response = h(ha1 + ":" + challenge.nonce + ":" + ha2)
+	} else {
+		response = h(ha1 + ":" + challenge.nonce + ":" + nc + ":" + cnonce + ":" + challenge.qop + ":" + ha2)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `Digest username=%q, realm=%q, nonce=%q, uri=%q, algorithm=%s, response=%q`,
+		a.username, challenge.realm, challenge.nonce, uri, challenge.algorithm, response)
+	if challenge.qop != "" {
+		fmt.Fprintf(&b, `, qop=%s, nc=%s, cnonce=%q`, challenge.qop, nc, cnonce)
+	}
+	if challenge.opaque != "" {
+		fmt.Fprintf(&b, `, opaque=%q`, challenge.opaque)
+	}
+	return b.String(), true, nil
+}
+
+// readRequestBody returns the body of req without consuming it, which
+// needs GetBody.
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody == nil {
+		return nil, fmt.Errorf("vortex: digest auth-int needs a replayable request body")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// parseDigestChallenge picks the Digest challenge to answer from the
+// WWW-Authenticate headers, preferring SHA-256 over MD5 and qop auth over
+// auth-int.
+func parseDigestChallenge(headers []string) (*digestChallenge, bool) {
+	var best *digestChallenge
+	for _, header := range headers {
+		scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+		if !strings.EqualFold(scheme, "Digest") {
+			continue
+		}
+		params := parseAuthParams(rest)
+		challenge := &digestChallenge{
+			realm:     params["realm"],
+			nonce:     params["nonce"],
+			opaque:    params["opaque"],
+			algorithm: params["algorithm"],
+			stale:     strings.EqualFold(params["stale"], "true"),
+		}
+		if challenge.algorithm == "" {
+			challenge.algorithm = "MD5"
+		}
+		switch strings.ToUpper(challenge.algorithm) {
+		case "MD5", "MD5-SESS", "SHA-256", "SHA-256-SESS":
+		default:
+			continue
+		}
+		if qop, ok := params["qop"]; ok {
+			for _, option := range strings.Split(qop, ",") {
+				option = strings.TrimSpace(option)
+				if option == "auth" || option == "auth-int" && challenge.qop == "" {
+					challenge.qop = option
+				}
+			}
+			if challenge.qop == "" {
+				continue
+			}
+		}
+		if challenge.nonce == "" {
+			continue
+		}
+		if best == nil || strings.HasPrefix(strings.ToUpper(challenge.algorithm), "SHA") && !strings.HasPrefix(strings.ToUpper(best.algorithm), "SHA") {
+			best = challenge
+		}
+	}
+	return best, best != nil
+}
+
+// parseAuthParams parses the comma separated key=value parameters of a
+// challenge, where values may be quoted strings.
+func parseAuthParams(s string) map[string]string {
+	params := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return params
+		}
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			return params
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " \t")
+
+		var value strings.Builder
+		if strings.HasPrefix(s, `"`) {
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				value.WriteByte(s[i])
+			}
+			if i < len(s) {
+				i++
+			}
+			s = s[i:]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			value.WriteString(strings.TrimSpace(s[:end]))
+			s = s[end:]
+		}
+		params[key] = value.String()
+	}
+}
+
+func hashHex(h hash.Hash, s string) string {
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func newCnonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
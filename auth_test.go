@@ -0,0 +1,177 @@
+package vortex
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestBasicAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "alice" || password != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	resp, err := New(Opt{BaseURL: server.URL}).SetBasicAuth("alice", "s3cret").Get("/")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected basic auth to be accepted, got %v, %v", resp, err)
+	}
+	expected := fmt.Sprintf(`curl -X GET "%s/" -H "Authorization: Basic [REDACTED]"`, server.URL)
+	if curl := resp.Request.GenerateCurlCommand(); curl != expected {
+		t.Errorf("expected %s, got %s", expected, curl)
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer abc.def" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	client := New(Opt{BaseURL: server.URL})
+	resp, err := client.R().SetBearerToken("abc.def").Get("/")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the bearer token to be accepted, got %v, %v", resp, err)
+	}
+	if curl := resp.Request.GenerateCurlCommand(); strings.Contains(curl, "abc.def") || !strings.Contains(curl, "Bearer [REDACTED]") {
+		t.Errorf("expected the token to be redacted, got %s", curl)
+	}
+
+	resp, err = client.R().SetBearerToken("abc.def").ShowCurlSecrets().Get("/")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if curl := resp.Request.GenerateCurlCommand(); !strings.Contains(curl, "Bearer abc.def") {
+		t.Errorf("expected the token to be shown, got %s", curl)
+	}
+}
+
+// digestServer challenges requests with HTTP Digest authentication and
+// verifies the responses independently of the client implementation.
+type digestServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	requests  int
+	ncs       []string
+	algorithm string
+	qop       string
+}
+
+func newDigestServer(algorithm, qop string) *digestServer {
+	s := &digestServer{algorithm: algorithm, qop: qop}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		s.requests++
+		s.mu.Unlock()
+
+		params := parseAuthParams(strings.TrimPrefix(r.Header.Get("Authorization"), "Digest "))
+		if !s.valid(r, body, params) {
+			w.Header().Add("WWW-Authenticate", `Basic realm="api"`)
+			w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Digest realm="api@example.com", qop="%s", algorithm=%s, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`, s.qop, s.algorithm))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		s.mu.Lock()
+		s.ncs = append(s.ncs, params["nc"])
+		s.mu.Unlock()
+		w.Write(body)
+	}))
+	return s
+}
+
+func (s *digestServer) valid(r *http.Request, body []byte, params map[string]string) bool {
+	if params["username"] != "Mufasa" || params["opaque"] != "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS" || params["uri"] != r.URL.RequestURI() {
+		return false
+	}
+	newHash := md5.New
+	if strings.HasPrefix(s.algorithm, "SHA-256") {
+		newHash = sha256.New
+	}
+	h := func(s string) string {
+		hash := newHash()
+		hash.Write([]byte(s))
+		return hex.EncodeToString(hash.Sum(nil))
+	}
+	ha1 := h("Mufasa:api@example.com:Circle of Life")
+	if strings.HasSuffix(s.algorithm, "-sess") {
+		ha1 = h(ha1 + ":" + params["nonce"] + ":" + params["cnonce"])
+	}
+	ha2 := h(r.Method + ":" + params["uri"])
+	if params["qop"] == "auth-int" {
+		ha2 = h(r.Method + ":" + params["uri"] + ":" + h(string(body)))
+	}
+	expected := h(ha1 + ":" + params["nonce"] + ":" + params["nc"] + ":" + params["cnonce"] + ":" + params["qop"] + ":" + ha2)
+	return params["response"] == expected
+}
+
+func TestDigestAuth(t *testing.T) {
+	for _, tc := range []struct{ algorithm, qop string }{
+		{"MD5", "auth"},
+		{"SHA-256", "auth,auth-int"},
+		{"SHA-256-sess", "auth-int"},
+	} {
+		t.Run(tc.algorithm+" "+tc.qop, func(t *testing.T) {
+			server := newDigestServer(tc.algorithm, tc.qop)
+			defer server.Close()
+
+			client := New(Opt{BaseURL: server.URL}).SetDigestAuth("Mufasa", "Circle of Life")
+			resp, err := client.Post("/dir/index.html?x=1", map[string]string{"name": "simba"})
+			if err != nil || resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected the digest challenge to be answered, got %v, %v", resp, err)
+			}
+			if string(resp.Body) != `{"name":"simba"}` {
+				t.Errorf("expected the body to be sent again, got %q", resp.Body)
+			}
+
+			resp, err = client.Get("/dir/index.html")
+			if err != nil || resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected the second request to be authorized, got %v, %v", resp, err)
+			}
+			if server.requests != 3 {
+				t.Errorf("expected the challenge to be reused, got %d requests", server.requests)
+			}
+			if strings.Join(server.ncs, ",") != "00000001,00000002" {
+				t.Errorf("expected nonce counts to increase, got %v", server.ncs)
+			}
+		})
+	}
+}
+
+func TestDigestAuthWrongPassword(t *testing.T) {
+	server := newDigestServer("MD5", "auth")
+	defer server.Close()
+
+	resp, err := New(Opt{BaseURL: server.URL}).SetDigestAuth("Mufasa", "wrong").Get("/")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized || server.requests != 2 {
+		t.Errorf("expected a single retry ending in 401, got %d after %d requests", resp.StatusCode, server.requests)
+	}
+	expected := fmt.Sprintf(`curl -X GET "%s/" --digest -u 'Mufasa:[REDACTED]'`, server.URL)
+	if curl := resp.Request.GenerateCurlCommand(); curl != expected {
+		t.Errorf("expected %s, got %s", expected, curl)
+	}
+}
+
+func TestParseAuthParams(t *testing.T) {
+	params := parseAuthParams(`realm="a, \"b\"", qop="auth,auth-int", algorithm=SHA-256, stale=TRUE`)
+	expected := map[string]string{"realm": `a, "b"`, "qop": "auth,auth-int", "algorithm": "SHA-256", "stale": "TRUE"}
+	for key, value := range expected {
+		if params[key] != value {
+			t.Errorf("expected %s=%q, got %q", key, value, params[key])
+		}
+	}
+}
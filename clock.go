@@ -0,0 +1,25 @@
+package vortex
+
+import "time"
+
+// Clock is the source of time used for retry backoff, retry budgets and
+// anything else that waits. Tests can replace it with a fake.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (c *Client) SetClock(clock Clock) *Client {
+	c.clock = clock
+	return c
+}
@@ -0,0 +1,230 @@
+package vortex
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// Codec encodes and decodes bodies of one media type.
+type Codec interface {
+	Encode(v interface{}) ([]byte, error)
+	Decode(data []byte, v interface{}) error
+}
+
+type JSONCodec struct{}
+
+func (JSONCodec) Encode(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Decode(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type XMLCodec struct{}
+
+func (XMLCodec) Encode(v interface{}) ([]byte, error) {
+	return xml.Marshal(v)
+}
+
+func (XMLCodec) Decode(data []byte, v interface{}) error {
+	return xml.Unmarshal(data, v)
+}
+
+// FormCodec handles application/x-www-form-urlencoded bodies. It decodes
+// into *url.Values, *map[string]string or *map[string][]string and encodes
+// those, plus structs through their json tags.
+type FormCodec struct{}
+
+func (FormCodec) Encode(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case url.Values:
+		return []byte(v.Encode()), nil
+	case map[string][]string:
+		return []byte(url.Values(v).Encode()), nil
+	case map[string]string:
+		values := url.Values{}
+		for key, value := range v {
+			values.Set(key, value)
+		}
+		return []byte(values.Encode()), nil
+	}
+
+	jsonParams, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var params map[string]interface{}
+	if err := json.Unmarshal(jsonParams, &params); err != nil {
+		return nil, fmt.Errorf("vortex: cannot form-encode %T", v)
+	}
+	values := url.Values{}
+	for key, value := range params {
+		values.Set(key, fmt.Sprintf("%v", value))
+	}
+	return []byte(values.Encode()), nil
+}
+
+func (FormCodec) Decode(data []byte, v interface{}) error {
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case *url.Values:
+		*v = values
+	case *map[string][]string:
+		*v = values
+	case *map[string]string:
+		*v = make(map[string]string, len(values))
+		for key := range values {
+			(*v)[key] = values.Get(key)
+		}
+	default:
+		return fmt.Errorf("vortex: cannot form-decode into %T", v)
+	}
+	return nil
+}
+
+// TextCodec passes bodies through as they are. It decodes into *string,
+// *[]byte or an io.Writer and encodes strings, byte slices and
+// fmt.Stringers.
+type TextCodec struct{}
+
+func (TextCodec) Encode(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	case fmt.Stringer:
+		return []byte(v.String()), nil
+	}
+	return nil, fmt.Errorf("vortex: cannot text-encode %T", v)
+}
+
+func (TextCodec) Decode(data []byte, v interface{}) error {
+	switch v := v.(type) {
+	case *string:
+		*v = string(data)
+	case *[]byte:
+		*v = append((*v)[:0], data...)
+	case io.Writer:
+		_, err := v.Write(data)
+		return err
+	default:
+		return fmt.Errorf("vortex: cannot text-decode into %T", v)
+	}
+	return nil
+}
+
+// NDJSONCodec handles newline-delimited JSON. It encodes a slice or array
+// as one JSON value per line and decodes lines into a pointer to a slice.
+type NDJSONCodec struct{}
+
+func (NDJSONCodec) Encode(v interface{}) ([]byte, error) {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return nil, fmt.Errorf("vortex: cannot NDJSON-encode %T", v)
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for i := 0; i < value.Len(); i++ {
+		if err := encoder.Encode(value.Index(i).Interface()); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (NDJSONCodec) Decode(data []byte, v interface{}) error {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("vortex: cannot NDJSON-decode into %T", v)
+	}
+
+	slice := value.Elem()
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		elem := reflect.New(slice.Type().Elem())
+		if err := decoder.Decode(elem.Interface()); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		slice.Set(reflect.Append(slice, elem.Elem()))
+	}
+}
+
+func defaultCodecs() map[string]Codec {
+	return map[string]Codec{
+		"application/json":                  JSONCodec{},
+		"application/xml":                   XMLCodec{},
+		"text/xml":                          XMLCodec{},
+		"application/x-www-form-urlencoded": FormCodec{},
+		"application/x-ndjson":              NDJSONCodec{},
+	}
+}
+
+// RegisterCodec sets the codec used for a media type, e.g.
+// "application/msgpack".
+func (c *Client) RegisterCodec(mediaType string, codec Codec) *Client {
+	c.codecs[strings.ToLower(mediaType)] = codec
+	return c
+}
+
+// SetDefaultCodec sets the codec used when the Content-Type is missing or
+// has no registered codec. It defaults to JSON.
+func (c *Client) SetDefaultCodec(codec Codec) *Client {
+	c.defaultCodec = codec
+	return c
+}
+
+// ForceCodec decodes the response with codec whatever its Content-Type.
+func (r *Request) ForceCodec(codec Codec) *Request {
+	r.codec = codec
+	return r
+}
+
+// codecFor returns the codec registered for contentType. Structured syntax
+// suffixes such as application/problem+json fall back to the codec of
+// their base type.
+func (c *Client) codecFor(contentType string) (Codec, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	if codec, ok := c.codecs[mediaType]; ok {
+		return codec, true
+	}
+	if i := strings.LastIndex(mediaType, "+"); i >= 0 {
+		codec, ok := c.codecs["application/"+mediaType[i+1:]]
+		return codec, ok
+	}
+	return nil, false
+}
+
+// responseCodec picks the codec for a response: the forced one, the text
+// codec for *string and *[]byte targets, then the one registered for the
+// Content-Type, then the default.
+func (r *Request) responseCodec(contentType string, target interface{}) Codec {
+	if r.codec != nil {
+		return r.codec
+	}
+	switch target.(type) {
+	case *string, *[]byte:
+		return TextCodec{}
+	}
+	if codec, ok := r.client.codecFor(contentType); ok {
+		return codec
+	}
+	return r.client.defaultCodec
+}
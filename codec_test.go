@@ -0,0 +1,172 @@
+package vortex
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func newContentServer(contentType, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.Write([]byte(body))
+	}))
+}
+
+func TestDecodeXML(t *testing.T) {
+	server := newContentServer("application/xml; charset=utf-8", `<user><name>vortex</name></user>`)
+	defer server.Close()
+
+	var output struct {
+		Name string `xml:"name"`
+	}
+	_, err := New(Opt{BaseURL: server.URL}).R().SetOutput(&output).Get("/test")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if output.Name != "vortex" {
+		t.Errorf("expected name to be vortex, got %s", output.Name)
+	}
+}
+
+func TestDecodeForm(t *testing.T) {
+	server := newContentServer("application/x-www-form-urlencoded", `access_token=abc&scope=read+write`)
+	defer server.Close()
+
+	var output url.Values
+	_, err := New(Opt{BaseURL: server.URL}).R().SetOutput(&output).Get("/test")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if output.Get("access_token") != "abc" || output.Get("scope") != "read write" {
+		t.Errorf("expected access_token abc and scope read write, got %v", output)
+	}
+}
+
+func TestDecodeStructuredSuffix(t *testing.T) {
+	server := newContentServer("application/problem+json", `{"title": "Not Found"}`)
+	defer server.Close()
+
+	var output struct {
+		Title string `json:"title"`
+	}
+	_, err := New(Opt{BaseURL: server.URL}).R().SetOutput(&output).Get("/test")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if output.Title != "Not Found" {
+		t.Errorf("expected title to be Not Found, got %s", output.Title)
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+	server := newContentServer("text/plain", `hello`)
+	defer server.Close()
+
+	var output string
+	_, err := New(Opt{BaseURL: server.URL}).R().SetOutput(&output).Get("/test")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if output != "hello" {
+		t.Errorf("expected output to be hello, got %s", output)
+	}
+
+	var raw []byte
+	_, err = New(Opt{BaseURL: server.URL}).R().SetOutput(&raw).Get("/test")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(raw) != "hello" {
+		t.Errorf("expected output to be hello, got %s", string(raw))
+	}
+}
+
+// csvCodec decodes "a,b,c" into a []string.
+type csvCodec struct{}
+
+func (csvCodec) Encode(v interface{}) ([]byte, error) {
+	return []byte(strings.Join(v.([]string), ",")), nil
+}
+
+func (csvCodec) Decode(data []byte, v interface{}) error {
+	*(v.(*[]string)) = strings.Split(string(data), ",")
+	return nil
+}
+
+func TestRegisterCodec(t *testing.T) {
+	server := newContentServer("text/csv", `a,b,c`)
+	defer server.Close()
+
+	var output []string
+	client := New(Opt{BaseURL: server.URL}).RegisterCodec("text/csv", csvCodec{})
+	_, err := client.R().SetOutput(&output).Get("/test")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if strings.Join(output, "|") != "a|b|c" {
+		t.Errorf("expected output to be [a b c], got %v", output)
+	}
+}
+
+func TestDefaultCodec(t *testing.T) {
+	server := newContentServer("application/vnd.unknown", `a,b`)
+	defer server.Close()
+
+	var output []string
+	client := New(Opt{BaseURL: server.URL}).SetDefaultCodec(csvCodec{})
+	_, err := client.R().SetOutput(&output).Get("/test")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(output) != 2 {
+		t.Errorf("expected output to be [a b], got %v", output)
+	}
+}
+
+func TestForceCodec(t *testing.T) {
+	server := newContentServer("application/json", `x,y`)
+	defer server.Close()
+
+	var output []string
+	_, err := New(Opt{BaseURL: server.URL}).R().ForceCodec(csvCodec{}).SetOutput(&output).Get("/test")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(output) != 2 || output[0] != "x" {
+		t.Errorf("expected output to be [x y], got %v", output)
+	}
+}
+
+func TestFormCodecEncode(t *testing.T) {
+	body, err := FormCodec{}.Encode(struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}{Name: "vortex", Age: 2})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(body) != "age=2&name=vortex" {
+		t.Errorf("expected age=2&name=vortex, got %s", string(body))
+	}
+
+	body, _ = FormCodec{}.Encode(map[string]string{"a": "1 2"})
+	if string(body) != "a=1+2" {
+		t.Errorf("expected a=1+2, got %s", string(body))
+	}
+}
+
+func TestTextCodec(t *testing.T) {
+	var buf bytes.Buffer
+	if err := (TextCodec{}).Decode([]byte("hello"), &buf); err != nil || buf.String() != "hello" {
+		t.Errorf("expected hello to be written, got %s (%v)", buf.String(), err)
+	}
+	if err := (TextCodec{}).Decode([]byte("hello"), &struct{}{}); err == nil {
+		t.Errorf("expected an error decoding text into a struct")
+	}
+}
@@ -0,0 +1,154 @@
+package vortex
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Content-Digest algorithms from the RFC 9530 registry.
+const (
+	DigestSHA256 = "sha-256"
+	DigestSHA512 = "sha-512"
+)
+
+var digestAlgorithms = map[string]func() hash.Hash{
+	DigestSHA256: sha256.New,
+	DigestSHA512: sha512.New,
+}
+
+// SetContentDigest sends a Content-Digest header (RFC 9530) computed with
+// algorithm, DigestSHA256 or DigestSHA512, with every request that has a
+// body.
+func (c *Client) SetContentDigest(algorithm string) *Client {
+	c.contentDigest = algorithm
+	return c
+}
+
+func (r *Request) SetContentDigest(algorithm string) *Request {
+	r.contentDigest = algorithm
+	return r
+}
+
+// VerifyContentDigest checks the Content-Digest header of responses
+// against their body. Responses without the header are accepted; bodies
+// that are not read into memory are not checked.
+func (c *Client) VerifyContentDigest() *Client {
+	c.verifyDigest = true
+	return c
+}
+
+func (r *Request) VerifyContentDigest() *Request {
+	r.verifyDigest = true
+	return r
+}
+
+// DigestError is returned when a Content-Digest header does not match the
+// body or cannot be checked. The response is returned alongside it.
+type DigestError struct {
+	Algorithm string
+	Reason    string
+}
+
+func (e *DigestError) Error() string {
+	if e.Algorithm == "" {
+		return "vortex: content digest: " + e.Reason
+	}
+	return fmt.Sprintf("vortex: content digest %s: %s", e.Algorithm, e.Reason)
+}
+
+// setContentDigest hashes the prepared request body into the
+// Content-Digest header. Streamed bodies are read through GetBody, so
+// one-shot readers cannot be digested.
+func (r *Request) setContentDigest(req *http.Request, body *requestBody) error {
+	newHash, ok := digestAlgorithms[r.contentDigest]
+	if !ok {
+		return &DigestError{Algorithm: r.contentDigest, Reason: "unsupported algorithm"}
+	}
+
+	var reader io.Reader
+	switch {
+	case body.data != nil:
+		reader = bytes.NewReader(body.data)
+	case req.Body == nil || req.Body == http.NoBody:
+		return nil
+	case req.GetBody != nil:
+		rc, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		reader = rc
+	default:
+		return &DigestError{Algorithm: r.contentDigest, Reason: "request body cannot be read twice"}
+	}
+
+	h := newHash()
+	if _, err := io.Copy(h, reader); err != nil {
+		return err
+	}
+	req.Header.Set("Content-Digest", r.contentDigest+"=:"+base64.StdEncoding.EncodeToString(h.Sum(nil))+":")
+	return nil
+}
+
+// verifyContentDigest checks every digest in header with a supported
+// algorithm against body. At least one must be supported.
+func verifyContentDigest(header string, body []byte) error {
+	members, err := parseDictionary(header)
+	if err != nil {
+		return &DigestError{Reason: "malformed header: " + err.Error()}
+	}
+	checked := false
+	for _, member := range members {
+		newHash, ok := digestAlgorithms[member.key]
+		if !ok {
+			continue
+		}
+		if member.bytes == nil {
+			return &DigestError{Algorithm: member.key, Reason: "value is not a byte sequence"}
+		}
+		h := newHash()
+		h.Write(body)
+		if !bytes.Equal(h.Sum(nil), member.bytes) {
+			return &DigestError{Algorithm: member.key, Reason: "does not match the body"}
+		}
+		checked = true
+	}
+	if !checked {
+		return &DigestError{Reason: "no supported algorithm in " + header}
+	}
+	return nil
+}
+
+// verifyBodyDigest checks body against the Content-Digest in header, if
+// there is one.
+func verifyBodyDigest(header http.Header, body []byte) error {
+	digest := strings.Join(header.Values("Content-Digest"), ", ")
+	if digest == "" {
+		return nil
+	}
+	return verifyContentDigest(digest, body)
+}
+
+// verifyResponse checks the response signature and Content-Digest when
+// configured. Bodies that were not read into memory are nil, as are those
+// of HEAD and 304 responses, whose Content-Digest describes content that
+// was not sent.
+func (r *Request) verifyResponse(resp *http.Response, body []byte) error {
+	if resp.StatusCode == http.StatusNotModified || resp.Request != nil && resp.Request.Method == http.MethodHead {
+		body = nil
+	}
+	if r.verifier != nil {
+		return r.verifier.VerifyResponse(resp, body)
+	}
+	if r.verifyDigest && body != nil {
+		return verifyBodyDigest(resp.Header, body)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package vortex
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContentDigest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Content-Digest") == "" {
+			t.Errorf("expected a Content-Digest header")
+		}
+		if err := verifyBodyDigest(r.Header, body); err != nil {
+			t.Errorf("expected the digest to match the body, got %v", err)
+		}
+		w.Write([]byte(r.Header.Get("Content-Digest")))
+	}))
+	defer server.Close()
+
+	client := New(Opt{BaseURL: server.URL}).SetContentDigest(DigestSHA256)
+	resp, err := client.Post("/", `{"hello": "world"}`)
+	if err != nil || string(resp.Body) != "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:" {
+		t.Errorf("expected the RFC 9530 sha-256 example, got %v, %v", resp, err)
+	}
+
+	resp, err = client.R().SetContentDigest(DigestSHA512).Post("/", `{"hello": "world"}`)
+	if err != nil || string(resp.Body) != "sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:" {
+		t.Errorf("expected the RFC 9530 sha-512 example, got %v, %v", resp, err)
+	}
+
+	path := writeTempFile(t, "id,total\n1,10\n")
+	if _, err := client.R().SetFormFilePath("report", path).Post("/", nil); err != nil {
+		t.Errorf("expected no error for a multipart body, got %v", err)
+	}
+}
+
+func TestVerifyContentDigest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Digest", r.URL.Query().Get("digest"))
+		fmt.Fprint(w, `{"hello": "world"}`)
+	}))
+	defer server.Close()
+
+	client := New(Opt{BaseURL: server.URL}).VerifyContentDigest()
+	resp, err := client.R().SetQueryParam("digest", "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:, md5=:aGVsbG8=:").Get("/")
+	if err != nil {
+		t.Errorf("expected a matching digest to be accepted, got %v", err)
+	}
+
+	resp, err = client.R().SetQueryParam("digest", "sha-256=:aGVsbG8=:").Get("/")
+	var digestErr *DigestError
+	if !errors.As(err, &digestErr) || digestErr.Algorithm != DigestSHA256 {
+		t.Fatalf("expected a sha-256 *DigestError, got %v", err)
+	}
+	if resp == nil || string(resp.Body) != `{"hello": "world"}` {
+		t.Errorf("expected the response to be returned with the error, got %+v", resp)
+	}
+
+	_, err = client.R().SetQueryParam("digest", "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:").execute(http.MethodHead, "/", nil)
+	if err != nil {
+		t.Errorf("expected the digest of a HEAD response not to be checked against its empty body, got %v", err)
+	}
+}
@@ -0,0 +1,237 @@
+package vortex
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// SetOutputFile streams the body of a 200 or 206 response to path instead
+// of Response.Body. The body is written to path+".part" and renamed once it
+// is complete. If a previous download to the same path was interrupted, the
+// request asks only for the missing bytes with Range and If-Range.
+func (r *Request) SetOutputFile(path string) *Request {
+	r.outputFile = path
+	return r
+}
+
+// SetChecksum verifies the file written by SetOutputFile against expected,
+// a hex-encoded digest computed with h, e.g. sha256.New(). A mismatch
+// removes the file and returns a *ChecksumError.
+func (r *Request) SetChecksum(h hash.Hash, expected string) *Request {
+	r.checksum = h
+	r.expectedChecksum = expected
+	return r
+}
+
+// Download gets endpoint and writes the response body to path.
+func (r *Request) Download(endpoint, path string) (*Response, error) {
+	return r.SetOutputFile(path).Get(endpoint)
+}
+
+// Download gets endpoint and writes the response body to path.
+func (c *Client) Download(endpoint, path string) (*Response, error) {
+	return c.R().Download(endpoint, path)
+}
+
+// ChecksumError is returned when a downloaded file does not match the
+// digest set with SetChecksum.
+type ChecksumError struct {
+	Path     string
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("vortex: checksum of %s is %s, expected %s", e.Path, e.Actual, e.Expected)
+}
+
+// downloadMeta is stored next to a partial download so that it can be
+// resumed only against the same resource.
+type downloadMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+func partPath(path string) string {
+	return path + ".part"
+}
+
+func metaPath(path string) string {
+	return path + ".part.json"
+}
+
+// prepareDownload asks for the rest of an interrupted download of the same
+// URL and returns the number of bytes already on disk. It returns 0 when
+// there is nothing to resume.
+func (r *Request) prepareDownload(req *http.Request) int64 {
+	info, err := os.Stat(partPath(r.outputFile))
+	if err != nil || info.Size() == 0 {
+		return 0
+	}
+
+	data, err := os.ReadFile(metaPath(r.outputFile))
+	if err != nil {
+		return 0
+	}
+	var meta downloadMeta
+	if err := json.Unmarshal(data, &meta); err != nil || meta.URL != req.URL.String() {
+		return 0
+	}
+
+	validator := meta.ETag
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		validator = meta.LastModified
+	}
+	if validator == "" {
+		return 0
+	}
+
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", info.Size()))
+	req.Header.Set("If-Range", validator)
+	return info.Size()
+}
+
+// isDownload reports whether resp carries the body that should go to the
+// output file.
+func (r *Request) isDownload(resp *http.Response, offset int64) bool {
+	if r.outputFile == "" {
+		return false
+	}
+	return resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent && offset > 0
+}
+
+// writeDownload streams resp to the partial file, appending when the server
+// resumed at offset, then verifies the checksum and moves the file in
+// place. An interrupted body leaves the partial file for the next attempt.
+func (r *Request) writeDownload(req *http.Request, resp *http.Response, offset int64) error {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resp.StatusCode == http.StatusPartialContent {
+		start, ok := contentRangeStart(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			return fmt.Errorf("vortex: unexpected Content-Range %q resuming at %d", resp.Header.Get("Content-Range"), offset)
+		}
+		flags = os.O_WRONLY | os.O_APPEND
+	} else {
+		offset = 0
+		if err := writeDownloadMeta(r.outputFile, req, resp); err != nil {
+			return err
+		}
+	}
+
+	if r.checksum != nil {
+		r.checksum.Reset()
+		if err := hashFile(r.checksum, partPath(r.outputFile), offset); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.OpenFile(partPath(r.outputFile), flags, 0o644)
+	if err != nil {
+		return err
+	}
+	var writer io.Writer = file
+	if r.checksum != nil {
+		writer = io.MultiWriter(file, r.checksum)
+	}
+
+	_, err = io.Copy(writer, resp.Body)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			return err
+		}
+		return newTransportError(req, contextError(r.Context(), r.timeoutError(err)))
+	}
+
+	if r.checksum != nil {
+		if err := r.verifyChecksum(); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Rename(partPath(r.outputFile), r.outputFile); err != nil {
+		return err
+	}
+	os.Remove(metaPath(r.outputFile))
+	return nil
+}
+
+// verifyChecksum compares the digest accumulated in r.checksum with the
+// expected one and removes the partial file when they differ.
+func (r *Request) verifyChecksum() error {
+	actual := hex.EncodeToString(r.checksum.Sum(nil))
+	if !strings.EqualFold(actual, r.expectedChecksum) {
+		removeDownload(r.outputFile)
+		return &ChecksumError{Path: r.outputFile, Expected: r.expectedChecksum, Actual: actual}
+	}
+	return nil
+}
+
+func writeDownloadMeta(path string, req *http.Request, resp *http.Response) error {
+	data, err := json.Marshal(downloadMeta{
+		URL:          req.URL.String(),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(metaPath(path), data, 0o644)
+}
+
+func removeDownload(path string) {
+	os.Remove(partPath(path))
+	os.Remove(metaPath(path))
+}
+
+// hashFile feeds the first n bytes of the file at path into h.
+func hashFile(h hash.Hash, path string, n int64) error {
+	if n == 0 {
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.CopyN(h, file, n)
+	return err
+}
+
+// contentRangeStart parses the first byte position of a Content-Range
+// header such as "bytes 100-199/200".
+func contentRangeStart(contentRange string) (int64, bool) {
+	rest, ok := cutPrefix(contentRange, "bytes ")
+	if !ok {
+		return 0, false
+	}
+	i := strings.IndexByte(rest, '-')
+	if i < 0 {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(rest[:i], 10, 64)
+	return start, err == nil
+}
+
+func cutPrefix(s, prefix string) (string, bool) {
+	if !strings.HasPrefix(s, prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
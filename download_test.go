@@ -0,0 +1,227 @@
+package vortex
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// downloadServer serves content with an ETag and records the Range and
+// If-Range headers it receives. When interrupt is set, the next response
+// is cut off halfway through the body.
+type downloadServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	content   []byte
+	etag      string
+	interrupt bool
+	ranges    []string
+	ifRanges  []string
+}
+
+func newDownloadServer(content string) *downloadServer {
+	s := &downloadServer{content: []byte(content), etag: `"v1"`}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.ranges = append(s.ranges, r.Header.Get("Range"))
+		s.ifRanges = append(s.ifRanges, r.Header.Get("If-Range"))
+		content, etag, interrupt := s.content, s.etag, s.interrupt
+		s.interrupt = false
+		s.mu.Unlock()
+
+		if r.URL.Path == "/missing" {
+			http.Error(w, "missing", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("ETag", etag)
+		if interrupt {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content[:len(content)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "export.csv", time.Time{}, bytes.NewReader(content))
+	}))
+	return s
+}
+
+func (s *downloadServer) set(content, etag string, interrupt bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.content, s.etag, s.interrupt = []byte(content), etag, interrupt
+}
+
+func (s *downloadServer) lastRange() (string, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ranges[len(s.ranges)-1], s.ifRanges[len(s.ifRanges)-1]
+}
+
+func assertFile(t *testing.T, path, expected string) {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected %s to exist, got %v", path, err)
+	}
+	if string(content) != expected {
+		t.Errorf("expected %s to hold %.20q, got %.20q", path, expected, string(content))
+	}
+	if _, err := os.Stat(partPath(path)); !os.IsNotExist(err) {
+		t.Errorf("expected the partial file to be removed, got %v", err)
+	}
+	if _, err := os.Stat(metaPath(path)); !os.IsNotExist(err) {
+		t.Errorf("expected the download metadata to be removed, got %v", err)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	content := strings.Repeat("row\n", 10000)
+	server := newDownloadServer(content)
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "export.csv")
+	resp, err := New(Opt{BaseURL: server.URL}).Download("/export", path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.File != path || len(resp.Body) != 0 {
+		t.Errorf("expected the body to go to %s, got file %s and %d bytes", path, resp.File, len(resp.Body))
+	}
+	assertFile(t, path, content)
+}
+
+func TestDownloadResume(t *testing.T) {
+	content := strings.Repeat("0123456789", 20000)
+	server := newDownloadServer(content)
+	defer server.Close()
+	server.set(content, `"v1"`, true)
+
+	path := filepath.Join(t.TempDir(), "export.csv")
+	client := New(Opt{BaseURL: server.URL})
+
+	_, err := client.Download("/export", path)
+	var transportErr *TransportError
+	if !errors.As(err, &transportErr) {
+		t.Fatalf("expected the interrupted download to fail with a *TransportError, got %v", err)
+	}
+	info, err := os.Stat(partPath(path))
+	if err != nil || info.Size() == 0 {
+		t.Fatalf("expected a partial file to be kept, got %v", err)
+	}
+
+	resp, err := client.R().Download("/export", path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Errorf("expected the download to resume with 206, got %d", resp.StatusCode)
+	}
+	rangeHeader, ifRange := server.lastRange()
+	if rangeHeader != "bytes="+strconv.FormatInt(info.Size(), 10)+"-" || ifRange != `"v1"` {
+		t.Errorf("expected Range bytes=%d- and If-Range \"v1\", got %s and %s", info.Size(), rangeHeader, ifRange)
+	}
+	assertFile(t, path, content)
+}
+
+func TestDownloadRestartsWhenResourceChanged(t *testing.T) {
+	server := newDownloadServer("")
+	defer server.Close()
+	server.set(strings.Repeat("a", 100000), `"v1"`, true)
+
+	path := filepath.Join(t.TempDir(), "export.csv")
+	client := New(Opt{BaseURL: server.URL})
+	if _, err := client.Download("/export", path); err == nil {
+		t.Fatal("expected the interrupted download to fail")
+	}
+
+	server.set(strings.Repeat("b", 1000), `"v2"`, false)
+	resp, err := client.Download("/export", path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected a full 200 response, got %d", resp.StatusCode)
+	}
+	assertFile(t, path, strings.Repeat("b", 1000))
+}
+
+func TestDownloadRangeNotSatisfiable(t *testing.T) {
+	server := newDownloadServer("short")
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "export.csv")
+	os.WriteFile(partPath(path), []byte("much longer than the resource"), 0o644)
+	os.WriteFile(metaPath(path), []byte(`{"url":"`+server.URL+`/export","etag":"\"v1\""}`), 0o644)
+
+	resp, err := New(Opt{BaseURL: server.URL}).Download("/export", path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the download to restart with 200, got %d", resp.StatusCode)
+	}
+	assertFile(t, path, "short")
+}
+
+func TestDownloadChecksum(t *testing.T) {
+	server := newDownloadServer("checked")
+	defer server.Close()
+
+	sum := sha256.Sum256([]byte("checked"))
+	path := filepath.Join(t.TempDir(), "export.csv")
+	_, err := New(Opt{BaseURL: server.URL}).R().
+		SetChecksum(sha256.New(), hex.EncodeToString(sum[:])).
+		Download("/export", path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	assertFile(t, path, "checked")
+
+	path = filepath.Join(t.TempDir(), "corrupt.csv")
+	resp, err := New(Opt{BaseURL: server.URL}).R().
+		SetChecksum(sha256.New(), strings.Repeat("0", 64)).
+		Download("/export", path)
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) {
+		t.Fatalf("expected a *ChecksumError, got %v", err)
+	}
+	if checksumErr.Actual != hex.EncodeToString(sum[:]) {
+		t.Errorf("expected the actual checksum %x, got %s", sum, checksumErr.Actual)
+	}
+	if resp == nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the response alongside the checksum error, got %+v", resp)
+	}
+	for _, p := range []string{path, partPath(path), metaPath(path)} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed, got %v", p, err)
+		}
+	}
+}
+
+func TestDownloadErrorStatus(t *testing.T) {
+	server := newDownloadServer("")
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "export.csv")
+	resp, err := New(Opt{BaseURL: server.URL}).Download("/missing", path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.StatusCode != http.StatusNotFound || !strings.Contains(string(resp.Body), "missing") {
+		t.Errorf("expected the 404 body in the response, got %d %s", resp.StatusCode, string(resp.Body))
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected no file to be written, got %v", err)
+	}
+}
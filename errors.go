@@ -0,0 +1,144 @@
+package vortex
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// TransportError is returned when a request could not be sent or its
+// response could not be read, e.g. because DNS resolution or the
+// connection failed, or the context was cancelled.
+type TransportError struct {
+	Method string
+	URL    string
+	Err    error
+}
+
+func newTransportError(req *http.Request, err error) *TransportError {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	return &TransportError{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Err:    err,
+	}
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("vortex: %s %s: %v", e.Method, e.URL, e.Err)
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports whether the error was caused by a timeout.
+func (e *TransportError) Timeout() bool {
+	var timeout interface{ Timeout() bool }
+	return errors.As(e.Err, &timeout) && timeout.Timeout()
+}
+
+// DecodeError is returned when the response body could not be decoded into
+// the output target. The response is returned alongside it.
+type DecodeError struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	Err         error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("vortex: decoding %d response (%s): %v", e.StatusCode, e.ContentType, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// ResponseTooLargeError is returned when a response body is larger than
+// the limit set with SetMaxResponseSize. ContentLength is the length the
+// server announced, or -1 when it did not.
+type ResponseTooLargeError struct {
+	Limit         int64
+	ContentLength int64
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("vortex: response body exceeds the limit of %d bytes", e.Limit)
+}
+
+// TimeoutError is returned when one of the configured timeouts expired.
+// Phase names it: "dial", "tls_handshake", "response_header", "read" or
+// "total". It is wrapped in a *TransportError.
+type TimeoutError struct {
+	Phase string
+	// Duration is the timeout that expired, 0 when it is not known.
+	Duration time.Duration
+	Err      error
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Duration == 0 {
+		return fmt.Sprintf("vortex: %s timeout expired", e.Phase)
+	}
+	return fmt.Sprintf("vortex: %s timeout of %s expired", e.Phase, e.Duration)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports true, so that TransportError.Timeout and net.Error
+// checks recognise it.
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// ErrorOnStatus makes requests return an *HTTPError, together with the
+// response, when the server answers with a non-2xx status.
+func (c *Client) ErrorOnStatus() *Client {
+	c.errorOnStatus = true
+	return c
+}
+
+func (r *Request) ErrorOnStatus() *Request {
+	r.errorOnStatus = true
+	return r
+}
+
+// HTTPError is returned for non-2xx responses when ErrorOnStatus is set.
+// The response is returned alongside it.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Body       []byte
+}
+
+func (e *HTTPError) Error() string {
+	if len(e.Body) == 0 {
+		return fmt.Sprintf("vortex: unexpected status %s", e.Status)
+	}
+	return fmt.Sprintf("vortex: unexpected status %s: %s", e.Status, truncate(e.Body, 256))
+}
+
+// Is makes errors.Is(err, &HTTPError{StatusCode: 404}) match any 404
+// error. A target without a status code matches every HTTPError.
+func (e *HTTPError) Is(target error) bool {
+	t, ok := target.(*HTTPError)
+	if !ok {
+		return false
+	}
+	return t.StatusCode == 0 || t.StatusCode == e.StatusCode
+}
+
+func truncate(body []byte, n int) string {
+	if len(body) <= n {
+		return string(body)
+	}
+	return string(body[:n]) + "..."
+}
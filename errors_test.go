@@ -0,0 +1,113 @@
+package vortex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTransportError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+
+	client := New(Opt{BaseURL: server.URL})
+	resp, err := client.Get("/test")
+
+	var transportErr *TransportError
+	if !errors.As(err, &transportErr) {
+		t.Fatalf("expected a *TransportError, got %v", err)
+	}
+	if transportErr.Method != "GET" || transportErr.URL != server.URL+"/test" {
+		t.Errorf("expected GET %s/test, got %s %s", server.URL, transportErr.Method, transportErr.URL)
+	}
+	if resp != nil {
+		t.Errorf("expected no response, got %+v", resp)
+	}
+}
+
+func TestTransportErrorWrapsContextError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	client := New(Opt{BaseURL: server.URL})
+	_, err := client.R().SetContext(ctx).Get("/test")
+
+	var transportErr *TransportError
+	if !errors.As(err, &transportErr) {
+		t.Fatalf("expected a *TransportError, got %v", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`<html>oops</html>`))
+	}))
+	defer server.Close()
+
+	var output map[string]interface{}
+	client := New(Opt{BaseURL: server.URL})
+	resp, err := client.R().SetOutput(&output).Get("/test")
+
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("expected a *DecodeError, got %v", err)
+	}
+	if decodeErr.ContentType != "text/html" || string(decodeErr.Body) != `<html>oops</html>` {
+		t.Errorf("expected the error to carry the body and content type, got %+v", decodeErr)
+	}
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("expected the error to wrap a *json.SyntaxError, got %v", decodeErr.Err)
+	}
+	if resp == nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the response alongside the decode error, got %+v", resp)
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`missing`))
+	}))
+	defer server.Close()
+
+	client := New(Opt{BaseURL: server.URL})
+
+	resp, err := client.Get("/test")
+	if err != nil {
+		t.Fatalf("expected no error without ErrorOnStatus, got %v", err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status code 404, got %d", resp.StatusCode)
+	}
+
+	resp, err = client.R().ErrorOnStatus().Get("/test")
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("expected an *HTTPError, got %v", err)
+	}
+	if httpErr.StatusCode != http.StatusNotFound || string(httpErr.Body) != "missing" {
+		t.Errorf("expected 404 missing, got %d %s", httpErr.StatusCode, string(httpErr.Body))
+	}
+	if !errors.Is(err, &HTTPError{StatusCode: http.StatusNotFound}) {
+		t.Errorf("expected errors.Is to match a 404 HTTPError")
+	}
+	if errors.Is(err, &HTTPError{StatusCode: http.StatusInternalServerError}) {
+		t.Errorf("expected errors.Is not to match a 500 HTTPError")
+	}
+	if resp == nil || string(resp.Body) != "missing" {
+		t.Errorf("expected the response alongside the HTTP error, got %+v", resp)
+	}
+}
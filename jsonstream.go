@@ -0,0 +1,141 @@
+package vortex
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"unicode"
+)
+
+// JSONStream decodes a body one element at a time. The body can be
+// newline-delimited JSON (any sequence of whitespace separated values) or
+// a single top-level JSON array, whose elements are yielded one by one.
+//
+//	stream := vortex.NewJSONStream[Item](resp.Body)
+//	for stream.Next() {
+//		item := stream.Value()
+//	}
+//	if err := stream.Err(); err != nil {
+//		...
+//	}
+type JSONStream[T any] struct {
+	reader  *bufio.Reader
+	decoder *json.Decoder
+	array   bool
+	value   T
+	err     error
+	done    bool
+}
+
+func NewJSONStream[T any](r io.Reader) *JSONStream[T] {
+	return &JSONStream[T]{reader: bufio.NewReader(r)}
+}
+
+// Next decodes the next element and reports whether there was one.
+func (s *JSONStream[T]) Next() bool {
+	if s.done {
+		return false
+	}
+	if s.decoder == nil {
+		if err := s.start(); err != nil {
+			return s.fail(err)
+		}
+	}
+
+	if s.array && !s.decoder.More() {
+		if _, err := s.decoder.Token(); err != nil {
+			return s.fail(err)
+		}
+		s.done = true
+		return false
+	}
+
+	var value T
+	if err := s.decoder.Decode(&value); err != nil {
+		if err == io.EOF && !s.array {
+			s.done = true
+			return false
+		}
+		return s.fail(err)
+	}
+	s.value = value
+	return true
+}
+
+// Value returns the element decoded by the last call to Next.
+func (s *JSONStream[T]) Value() T {
+	return s.value
+}
+
+// Err returns the error that stopped the stream, if any.
+func (s *JSONStream[T]) Err() error {
+	return s.err
+}
+
+// start looks at the first byte of the body to tell an array from a
+// sequence of values.
+func (s *JSONStream[T]) start() error {
+	for {
+		b, err := s.reader.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				s.decoder = json.NewDecoder(s.reader)
+				return nil
+			}
+			return err
+		}
+		if unicode.IsSpace(rune(b)) {
+			continue
+		}
+		if err := s.reader.UnreadByte(); err != nil {
+			return err
+		}
+		break
+	}
+
+	s.decoder = json.NewDecoder(s.reader)
+	first, err := s.reader.Peek(1)
+	if err == nil && first[0] == '[' {
+		if _, err := s.decoder.Token(); err != nil {
+			return err
+		}
+		s.array = true
+	}
+	return nil
+}
+
+func (s *JSONStream[T]) fail(err error) bool {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	s.err = err
+	s.done = true
+	return false
+}
+
+// EachJSON sends the request and calls fn with every element of a 2xx
+// response body as it is decoded, without buffering the body. Other
+// responses are read and decoded as usual. Returning an error from fn stops
+// the stream and is returned by EachJSON.
+func EachJSON[T any](r *Request, method, endpoint string, body interface{}, fn func(T) error) (*Response, error) {
+	resp, err := r.Streaming().execute(method, endpoint, body)
+	if err != nil || resp.RawBody == nil {
+		return resp, err
+	}
+	defer resp.RawBody.Close()
+
+	stream := NewJSONStream[T](resp.RawBody)
+	for stream.Next() {
+		if err := fn(stream.Value()); err != nil {
+			return resp, err
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return resp, &DecodeError{
+			StatusCode:  resp.StatusCode,
+			ContentType: resp.Header("Content-Type"),
+			Err:         err,
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,130 @@
+package vortex
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type streamItem struct {
+	ID int `json:"id"`
+}
+
+func TestJSONStream(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"ndjson", "{\"id\": 1}\n{\"id\": 2}\n\n{\"id\": 3}\n"},
+		{"array", ` [ {"id": 1}, {"id": 2},
+			{"id": 3} ] `},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := NewJSONStream[streamItem](strings.NewReader(tt.body))
+			var ids []int
+			for stream.Next() {
+				ids = append(ids, stream.Value().ID)
+			}
+			if err := stream.Err(); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(ids) != 3 || ids[0] != 1 || ids[2] != 3 {
+				t.Errorf("expected ids 1,2,3, got %v", ids)
+			}
+		})
+	}
+}
+
+func TestJSONStreamErrors(t *testing.T) {
+	for _, body := range []string{`[{"id": 1}, {"id": `, "{\"id\": 1}\n{\"id\": \"x\"}\n"} {
+		stream := NewJSONStream[streamItem](strings.NewReader(body))
+		count := 0
+		for stream.Next() {
+			count++
+		}
+		if count != 1 || stream.Err() == nil {
+			t.Errorf("expected one element and an error for %q, got %d and %v", body, count, stream.Err())
+		}
+	}
+
+	stream := NewJSONStream[streamItem](strings.NewReader(""))
+	if stream.Next() || stream.Err() != nil {
+		t.Errorf("expected an empty body to yield nothing, got %v", stream.Err())
+	}
+}
+
+func TestEachJSONDoesNotBuffer(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write([]byte("{\"id\": 1}\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("{\"id\": 2}\n"))
+	}))
+	defer server.Close()
+
+	var ids []int
+	resp, err := EachJSON(New(Opt{BaseURL: server.URL}).R(), "GET", "/items", nil, func(item streamItem) error {
+		ids = append(ids, item.ID)
+		if item.ID == 1 {
+			close(release)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(ids) != 2 {
+		t.Errorf("expected two items, got %v", ids)
+	}
+	if resp.StatusCode != http.StatusOK || len(resp.Body) != 0 {
+		t.Errorf("expected a 200 response without a buffered body, got %d and %d bytes", resp.StatusCode, len(resp.Body))
+	}
+}
+
+func TestEachJSONStop(t *testing.T) {
+	server := newContentServer("application/json", `[{"id": 1}, {"id": 2}, {"id": 3}]`)
+	defer server.Close()
+
+	errStop := errors.New("stop")
+	count := 0
+	_, err := EachJSON(New(Opt{BaseURL: server.URL}).R(), "GET", "/items", nil, func(item streamItem) error {
+		count++
+		if item.ID == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) || count != 2 {
+		t.Errorf("expected to stop after two items with the callback error, got %d and %v", count, err)
+	}
+}
+
+func TestEachJSONErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"message": "bad"}`)
+	}))
+	defer server.Close()
+
+	var apiErr struct {
+		Message string `json:"message"`
+	}
+	resp, err := EachJSON(New(Opt{BaseURL: server.URL}).R().SetError(&apiErr), "GET", "/items", nil, func(item streamItem) error {
+		t.Errorf("expected no items, got %+v", item)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest || apiErr.Message != "bad" {
+		t.Errorf("expected the error body to be decoded, got %d %+v", resp.StatusCode, apiErr)
+	}
+}
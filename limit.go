@@ -0,0 +1,111 @@
+package vortex
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// SetMaxResponseSize limits how many bytes of a response body are read into
+// memory. Larger bodies fail with a *ResponseTooLargeError. Bodies written
+// to a file or handed to a stream handler are not limited. 0 means no limit.
+func (c *Client) SetMaxResponseSize(n int64) *Client {
+	c.maxBodySize = n
+	return c
+}
+
+// SetMaxResponseSize limits how many bytes of the response body are read
+// into memory. Larger bodies fail with a *ResponseTooLargeError.
+func (r *Request) SetMaxResponseSize(n int64) *Request {
+	r.maxBodySize = n
+	return r
+}
+
+// SetReadTimeout aborts a response body when no data arrives for d while
+// it is being read. The read fails with a *TimeoutError and the connection
+// is closed. Unlike Opt.Timeout it does not limit how long a body that
+// keeps arriving may take. 0 disables it.
+func (c *Client) SetReadTimeout(d time.Duration) *Client {
+	c.readTimeout = d
+	return c
+}
+
+// SetReadTimeout aborts the response body when no data arrives for d while
+// it is being read.
+func (r *Request) SetReadTimeout(d time.Duration) *Request {
+	r.readTimeout = d
+	return r
+}
+
+// readBody reads resp.Body into memory, up to the configured limit.
+func (r *Request) readBody(resp *http.Response) ([]byte, error) {
+	limit := r.maxBodySize
+	if limit <= 0 {
+		return io.ReadAll(resp.Body)
+	}
+	if resp.ContentLength > limit {
+		return nil, &ResponseTooLargeError{Limit: limit, ContentLength: resp.ContentLength}
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, &ResponseTooLargeError{Limit: limit, ContentLength: resp.ContentLength}
+	}
+	return body, nil
+}
+
+// withReadTimeout derives the context a request with a read timeout is sent
+// with, so that an expired timeout can close its connection. The returned
+// function wraps the response body once it arrives.
+func (r *Request) withReadTimeout(ctx context.Context) (context.Context, context.CancelFunc, func(*http.Response)) {
+	if r.readTimeout <= 0 {
+		return ctx, func() {}, func(*http.Response) {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return ctx, cancel, func(resp *http.Response) {
+		resp.Body = &idleTimeoutBody{ReadCloser: resp.Body, timeout: r.readTimeout, cancel: cancel}
+	}
+}
+
+// idleTimeoutBody cancels the request when a single Read waits longer than
+// timeout. Time spent between reads does not count, so a slow consumer is
+// not mistaken for a stalled server.
+type idleTimeoutBody struct {
+	io.ReadCloser
+	timeout time.Duration
+	cancel  context.CancelFunc
+	timer   *time.Timer
+	expired int32
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.timeout, b.expire)
+	} else {
+		b.timer.Reset(b.timeout)
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.timer.Stop()
+	if atomic.LoadInt32(&b.expired) == 1 {
+		return n, &TimeoutError{Phase: "read", Duration: b.timeout}
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+func (b *idleTimeoutBody) expire() {
+	atomic.StoreInt32(&b.expired, 1)
+	b.cancel()
+}
@@ -0,0 +1,127 @@
+package vortex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaxResponseSize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := strings.Repeat("x", 100)
+		if r.URL.Query().Get("chunked") == "" {
+			w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+		}
+		w.Write([]byte(body))
+		w.(http.Flusher).Flush()
+	}))
+	defer server.Close()
+
+	client := New(Opt{BaseURL: server.URL}).SetMaxResponseSize(50)
+	for _, endpoint := range []string{"/", "/?chunked=1"} {
+		resp, err := client.Get(endpoint)
+		var tooLarge *ResponseTooLargeError
+		if !errors.As(err, &tooLarge) || tooLarge.Limit != 50 {
+			t.Errorf("%s: expected a *ResponseTooLargeError with limit 50, got %v", endpoint, err)
+		}
+		if resp != nil {
+			t.Errorf("%s: expected no response, got %+v", endpoint, resp)
+		}
+	}
+
+	resp, err := client.R().SetMaxResponseSize(100).Get("/?chunked=1")
+	if err != nil || len(resp.Body) != 100 {
+		t.Errorf("expected a body at the request limit to be read, got %d bytes, %v", len(resp.Body), err)
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "partial")
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	_, err := New(Opt{BaseURL: server.URL}).SetReadTimeout(50 * time.Millisecond).Get("/")
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Phase != "read" {
+		t.Fatalf("expected a read *TimeoutError, got %v", err)
+	}
+	var transportErr *TransportError
+	if !errors.As(err, &transportErr) || !transportErr.Timeout() {
+		t.Errorf("expected a *TransportError reporting a timeout, got %v", err)
+	}
+}
+
+func TestReadTimeoutIgnoresSlowConsumer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "first second")
+	}))
+	defer server.Close()
+
+	resp, err := New(Opt{BaseURL: server.URL}).R().
+		SetReadTimeout(20 * time.Millisecond).
+		Streaming().
+		Get("/")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer resp.RawBody.Close()
+
+	buf := make([]byte, len("first "))
+	if _, err := io.ReadFull(resp.RawBody, buf); err != nil {
+		t.Fatalf("expected the first chunk, got %v", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	rest, err := io.ReadAll(resp.RawBody)
+	if err != nil || string(rest) != "second" {
+		t.Errorf("expected time between reads not to count, got %q, %v", rest, err)
+	}
+}
+
+// doneContext hides its cancelCtx parent, so each context derived from it
+// is watched by a goroutine until it is cancelled.
+type doneContext struct {
+	context.Context
+	done chan struct{}
+}
+
+func (c doneContext) Done() <-chan struct{} { return c.done }
+
+func TestReadTimeoutReleasedOnEarlyReturn(t *testing.T) {
+	ctx := doneContext{Context: context.Background(), done: make(chan struct{})}
+	defer close(ctx.done)
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 20; i++ {
+		_, err := New(Opt{BaseURL: "http://127.0.0.1:1"}).R().
+			SetContext(ctx).
+			SetReadTimeout(time.Second).
+			SetContentDigest("md5").
+			Post("/", "body")
+		var digestErr *DigestError
+		if !errors.As(err, &digestErr) {
+			t.Fatalf("expected a *DigestError, got %v", err)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before+5 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before+5 {
+		t.Errorf("expected the read timeout contexts to be cancelled, got %d goroutines, had %d", after, before)
+	}
+}
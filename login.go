@@ -0,0 +1,38 @@
+package vortex
+
+import "context"
+
+// LoginFunc obtains a session token, e.g. by posting credentials to a login
+// endpoint. Requests it sends with the context it is given are not
+// authenticated, so it can use the client it authenticates.
+type LoginFunc func(ctx context.Context) (*Token, error)
+
+// LoginTokenSource logs in for the first request, attaches the session
+// token to every request and logs in again when the server rejects the
+// token with 401 or it is about to expire. Concurrent requests share a
+// single login.
+type LoginTokenSource struct {
+	*tokenCache
+}
+
+func NewLoginTokenSource(login LoginFunc) *LoginTokenSource {
+	return &LoginTokenSource{tokenCache: &tokenCache{
+		fetch: func(ctx context.Context, current *Token) (*Token, error) {
+			return login(ctx)
+		},
+		clock:       realClock{},
+		earlyExpiry: defaultEarlyExpiry,
+	}}
+}
+
+// SetClock sets the clock used to tell when tokens expire.
+func (s *LoginTokenSource) SetClock(clock Clock) *LoginTokenSource {
+	s.clock = clock
+	return s
+}
+
+// SetLogin authenticates every request with a session token obtained by
+// login, logging in again once when a request gets a 401.
+func (c *Client) SetLogin(login LoginFunc) *Client {
+	return c.SetTokenSource(NewLoginTokenSource(login))
+}
@@ -0,0 +1,115 @@
+package vortex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// sessionServer issues a new session token on every login and only accepts
+// the latest one on other endpoints.
+type sessionServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	logins  int
+	session string
+}
+
+func newSessionServer() *sessionServer {
+	s := &sessionServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if r.URL.Path == "/api/auth/login" {
+			if r.Header.Get("Authorization") != "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			s.logins++
+			s.session = fmt.Sprintf("session-%d", s.logins)
+			json.NewEncoder(w).Encode(map[string]string{"token": s.session})
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer "+s.session {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s", s.session, body)
+	}))
+	return s
+}
+
+// Expire ends the current session.
+func (s *sessionServer) Expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.session = "expired"
+}
+
+func newLoginClient(server *sessionServer) *Client {
+	client := New(Opt{BaseURL: server.URL})
+	return client.SetLogin(func(ctx context.Context) (*Token, error) {
+		var login struct {
+			Token string `json:"token"`
+		}
+		_, err := client.R().
+			SetContext(ctx).
+			SetOutput(&login).
+			ErrorOnStatus().
+			Post("/api/auth/login", map[string]string{"email": "admin@lakasir.test"})
+		if err != nil {
+			return nil, err
+		}
+		return &Token{AccessToken: login.Token}, nil
+	})
+}
+
+func TestLoginRelogsOnUnauthorized(t *testing.T) {
+	server := newSessionServer()
+	defer server.Close()
+	client := newLoginClient(server)
+
+	resp, err := client.Get("/api/auth/me")
+	if err != nil || string(resp.Body) != "session-1 " {
+		t.Fatalf("expected the request to use the first session, got %v, %v", resp, err)
+	}
+
+	server.Expire()
+	resp, err = client.Post("/api/orders", map[string]string{"id": "1"})
+	if err != nil || string(resp.Body) != `session-2 {"id":"1"}` {
+		t.Fatalf("expected the request to be replayed after logging in again, got %v, %v", resp, err)
+	}
+	if server.logins != 2 {
+		t.Errorf("expected 2 logins, got %d", server.logins)
+	}
+}
+
+func TestLoginConcurrentRequests(t *testing.T) {
+	server := newSessionServer()
+	defer server.Close()
+	client := newLoginClient(server)
+
+	for round := 1; round <= 2; round++ {
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if resp, err := client.Get("/api/auth/me"); err != nil || resp.StatusCode != http.StatusOK {
+					t.Errorf("expected the request to succeed, got %v, %v", resp, err)
+				}
+			}()
+		}
+		wg.Wait()
+		if server.logins != round {
+			t.Errorf("expected %d logins after round %d, got %d", round, round, server.logins)
+		}
+		server.Expire()
+	}
+}
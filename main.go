@@ -1,20 +1,19 @@
 package vortex
 
 import (
-	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"hash"
 	"io"
 	"log"
 	"mime/multipart"
 	"net/http"
-	"net/http/httptest"
 	"net/url"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 type Middleware func(req *http.Request, next http.HandlerFunc) http.HandlerFunc
@@ -31,20 +30,44 @@ type Client struct {
 	httpClient    *http.Client
 	baseURL       string
 	retries       int
+	retry         retryConfig
+	clock         Clock
+	codecs        map[string]Codec
+	defaultCodec  Codec
 	headers       http.Header
 	queryParams   url.Values
 	output        interface{}
-	middleware    []Middleware
+	errorOutput   interface{}
+	resultFor     map[int]interface{}
+	middleware    []RoundTripMiddleware
 	hooks         []Hook
 	streamHandler func(*http.Response) error
 	formFilePath  map[string]string
 	formData      map[string]string
 	insecure      bool
-	formFile     map[string]multipart.File
+	errorOnStatus bool
+	chunked       bool
+	progress      progressConfig
+	segments      int
+	streaming     bool
+	maxBodySize   int64
+	readTimeout   time.Duration
+	timeouts      Timeouts
+	digest        *digestAuth
+	showSecrets   bool
+	tokenSource   TokenSource
+	sigV4         *SigV4Signer
+	contentDigest string
+	verifyDigest  bool
+	messageSigner *MessageSigner
+	verifier      *MessageVerifier
+	formFile      map[string]multipart.File
 }
 
 func (c *Client) UseMiddleware(middleware ...Middleware) *Client {
-	c.middleware = append(c.middleware, middleware...)
+	for _, m := range middleware {
+		c.middleware = append(c.middleware, m.RoundTripMiddleware())
+	}
 	return c
 }
 
@@ -58,16 +81,26 @@ func New(opt Opt) *Client {
 		httpClient: &http.Client{
 			Timeout: opt.Timeout,
 		},
-		baseURL:     opt.BaseURL,
-		retries:     opt.Retries,
-		headers:     http.Header{},
-		queryParams: url.Values{},
-		insecure:    false,
+		baseURL:      opt.BaseURL,
+		retries:      opt.Retries,
+		retry:        newRetryConfig(),
+		clock:        realClock{},
+		codecs:       defaultCodecs(),
+		defaultCodec: JSONCodec{},
+		progress:     progressConfig{interval: defaultProgressInterval},
+		headers:      http.Header{},
+		queryParams:  url.Values{},
+		insecure:     false,
 	}
 }
 
 func (c *Client) Insecure() *Client {
 	c.insecure = true
+	transport := c.transport()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.InsecureSkipVerify = true
 	return c
 }
 
@@ -122,6 +155,11 @@ func (c *Client) SetQueryParams(params map[string]interface{}) *Client {
 }
 
 func (c *Client) SetQueryParamFromInterface(params interface{}) *Client {
+	setQueryParamFromInterface(c.queryParams, params)
+	return c
+}
+
+func setQueryParamFromInterface(values url.Values, params interface{}) {
 	jsonParams, _ := json.Marshal(params)
 	var queryParams map[string]interface{}
 	err := json.Unmarshal(jsonParams, &queryParams)
@@ -130,9 +168,8 @@ func (c *Client) SetQueryParamFromInterface(params interface{}) *Client {
 	}
 
 	for key, value := range queryParams {
-		c.queryParams.Set(key, fmt.Sprintf("%v", value))
+		values.Set(key, fmt.Sprintf("%v", value))
 	}
-	return c
 }
 
 func (c *Client) SetOutput(output interface{}) *Client {
@@ -140,201 +177,37 @@ func (c *Client) SetOutput(output interface{}) *Client {
 	return c
 }
 
-func (c *Client) doRequest(method, endpoint string, body interface{}) (response *Response, err error) {
-	reqBody, jsonBody, writer, err := c.prepareRequestBody(body)
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequest(method, c.baseURL+endpoint, reqBody)
-	if err != nil {
-		return nil, err
-	}
-
-	c.setRequestHeaders(req, method, writer)
-
-	var request Request
-	handler := c.createHandler(method, req, jsonBody, &request)
-
-	for i := len(c.middleware) - 1; i >= 0; i-- {
-		handler = c.middleware[i](req, handler)
-	}
-
-	recorder := httptest.NewRecorder()
-	handler.ServeHTTP(recorder, req)
-
-	return &Response{
-		StatusCode: recorder.Result().StatusCode,
-		Body:       recorder.Body.Bytes(),
-		Output:     c.output,
-		Request:    &request,
-	}, nil
-}
-
-func (c *Client) prepareRequestBody(body interface{}) (io.Reader, []byte, *multipart.Writer, error) {
-	var reqBody io.Reader
-	var jsonBody []byte
-	var bodyBuffer *bytes.Buffer
-	var writer *multipart.Writer
-	var err error
-
-	if len(c.formFilePath) > 0 || len(c.formData) > 0 || len(c.formFile) > 0 {
-		bodyBuffer = &bytes.Buffer{}
-		writer = multipart.NewWriter(bodyBuffer)
-		err = c.writeFormData(writer)
-		if err != nil {
-			return nil, nil, nil, err
-		}
-		reqBody = bodyBuffer
-	} else if body != nil {
-		jsonBody, err = json.Marshal(body)
-		if err != nil {
-			return nil, nil, nil, err
-		}
-		reqBody = bytes.NewBuffer(jsonBody)
-	}
-
-	return reqBody, jsonBody, writer, nil
-}
-
-func (c *Client) writeFormData(writer *multipart.Writer) error {
-	for key, filePath := range c.formFilePath {
-		file, err := os.Open(filePath)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
-
-		part, err := writer.CreateFormFile(key, filepath.Base(file.Name()))
-		if err != nil {
-			return err
-		}
-
-		_, err = io.Copy(part, file)
-		if err != nil {
-			return err
-		}
-	}
-
-	for key, value := range c.formData {
-		_ = writer.WriteField(key, value)
-	}
-
-	for fieldname, file := range c.formFile {
-		fileHeader, ok := file.(*os.File)
-		if !ok {
-			return fmt.Errorf("file is not an *os.File")
-		}
-		defer fileHeader.Close()
-		part, err := writer.CreateFormFile(fieldname, fileHeader.Name())
-		if err != nil {
-			return err
-		}
-		_, err = io.Copy(part, file)
-		if err != nil {
-			return err
-		}
-	}
-
-	return writer.Close()
+func (c *Client) SetError(errorOutput interface{}) *Client {
+	c.errorOutput = errorOutput
+	return c
 }
 
-func (c *Client) setRequestHeaders(req *http.Request, method string, writer *multipart.Writer) {
-	switch method {
-	case "GET", "DELETE":
-		req.URL.RawQuery = c.queryParams.Encode()
-	case "POST", "PUT", "PATCH":
-		if c.headers.Get("Content-Type") == "" && len(c.formFilePath) == 0 {
-			req.Header.Set("Content-Type", "application/json")
-		}
+func (c *Client) SetResultFor(statusCode int, target interface{}) *Client {
+	if c.resultFor == nil {
+		c.resultFor = make(map[int]interface{})
 	}
-
-	if len(c.formFilePath) > 0 || len(c.formData) > 0 || len(c.formFile) > 0 {
-		req.Header.Set("Content-Type", writer.FormDataContentType())
-	}
-
-	c.addHeaders(req)
-}
-
-func (c *Client) createHandler(method string, req *http.Request, jsonBody []byte, request *Request) http.HandlerFunc {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		httpClient := c.httpClient
-		if c.insecure {
-			println("insecure")
-			httpClient.Transport = &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: c.insecure},
-			}
-		}
-		resp, err := httpClient.Do(r)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		defer resp.Body.Close()
-
-		for _, hook := range c.hooks {
-			hook(r, resp)
-		}
-
-		if c.streamHandler != nil {
-			err := c.streamHandler(resp)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
-
-		respBody, _ := io.ReadAll(resp.Body)
-
-		var output interface{}
-		if c.output != nil {
-			output = c.output
-			err = json.Unmarshal(respBody, output)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
-
-		*request = Request{
-			Method:       method,
-			URL:          req.URL.String(),
-			Headers:      req.Header,
-			Body:         jsonBody,
-			FormFilePath: c.formFilePath,
-			FormData:     c.formData,
-			FormFile:     c.formFile,
-			insecure:     c.insecure,
-		}
-
-		w.Header().Set("StatusCode", fmt.Sprintf("%d", resp.StatusCode))
-		w.WriteHeader(resp.StatusCode)
-		_, err = w.Write(respBody)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-	})
+	c.resultFor[statusCode] = target
+	return c
 }
 
 func (c *Client) Get(endpoint string) (*Response, error) {
-	return c.doRequest("GET", endpoint, nil)
+	return c.R().Get(endpoint)
 }
 
 func (c *Client) Delete(endpoint string) (*Response, error) {
-	return c.doRequest("DELETE", endpoint, nil)
+	return c.R().Delete(endpoint)
 }
 
 func (c *Client) Post(endpoint string, body interface{}) (*Response, error) {
-	return c.doRequest("POST", endpoint, body)
+	return c.R().Post(endpoint, body)
 }
 
 func (c *Client) Put(endpoint string, body interface{}) (*Response, error) {
-	return c.doRequest("PUT", endpoint, body)
+	return c.R().Put(endpoint, body)
 }
 
 func (c *Client) Patch(endpoint string, body interface{}) (*Response, error) {
-	return c.doRequest("PATCH", endpoint, body)
+	return c.R().Patch(endpoint, body)
 }
 
 func (c *Client) Stream(streamHandler func(*http.Response) error) *Client {
@@ -342,19 +215,26 @@ func (c *Client) Stream(streamHandler func(*http.Response) error) *Client {
 	return c
 }
 
-func (c *Client) addHeaders(req *http.Request) {
-	for key, values := range c.headers {
-		for _, value := range values {
-			req.Header.Add(key, value)
-		}
-	}
-}
-
 type Response struct {
-	StatusCode int
-	Body       []byte
-	Output     interface{}
-	Request    *Request
+	StatusCode    int
+	Status        string
+	Body          []byte
+	Output        interface{}
+	ErrorOutput   interface{}
+	Result        interface{}
+	Request       *Request
+	Headers       http.Header
+	Cookies       []*http.Cookie
+	Trailer       http.Header
+	Proto         string
+	ContentLength int64
+	FinalURL      string
+	TLS           *tls.ConnectionState
+	Attempts      int
+	Duration      time.Duration
+	File          string
+	Segments      int
+	RawBody       io.ReadCloser
 }
 
 type Request struct {
@@ -367,11 +247,42 @@ type Request struct {
 	FormData     map[string]string
 	FormFile     map[string]multipart.File
 	insecure     bool
+	bodyStream   bool
+	parts        []formPart
+
+	client        *Client
+	ctx           context.Context
+	retry         retryConfig
+	errorOnStatus bool
+	chunked       bool
+	progress      progressConfig
+	output        interface{}
+	errorOutput   interface{}
+	resultFor     map[int]interface{}
+	codec         Codec
+	streamHandler func(*http.Response) error
+
+	outputFile       string
+	segments         int
+	streaming        bool
+	maxBodySize      int64
+	readTimeout      time.Duration
+	timeout          time.Duration
+	digest           *digestAuth
+	showSecrets      bool
+	tokenSource      TokenSource
+	sigV4            *SigV4Signer
+	contentDigest    string
+	verifyDigest     bool
+	messageSigner    *MessageSigner
+	verifier         *MessageVerifier
+	checksum         hash.Hash
+	expectedChecksum string
 }
 
 type NamedFile interface {
-    Name() string
-    multipart.File
+	Name() string
+	multipart.File
 }
 
 func (r *Request) GenerateCurlCommand() string {
@@ -385,18 +296,25 @@ func (r *Request) GenerateCurlCommand() string {
 
 	if len(r.QueryParams) > 0 {
 		curlCommand.WriteString(r.URL)
-		curlCommand.WriteString("?")
+		if strings.Contains(r.URL, "?") {
+			curlCommand.WriteString("&")
+		} else {
+			curlCommand.WriteString("?")
+		}
 		curlCommand.WriteString(r.QueryParams.Encode())
 	} else {
 		curlCommand.WriteString(r.URL)
 	}
 	curlCommand.WriteString("\"")
 
-	for key, values := range r.Headers {
-		for _, value := range values {
+	for _, key := range sortedKeys(r.Headers) {
+		for _, value := range r.Headers[key] {
 			if key == "Content-Type" && strings.Contains(value, "boundary") {
 				value = strings.Split(value, ";")[0]
 			}
+			if isSecretHeader(key) && !r.showSecrets {
+				value = redactCredentials(value)
+			}
 			curlCommand.WriteString(" -H \"")
 			curlCommand.WriteString(key)
 			curlCommand.WriteString(": ")
@@ -405,26 +323,36 @@ func (r *Request) GenerateCurlCommand() string {
 		}
 	}
 
-	if (r.Method == "POST" || r.Method == "PUT" || r.Method == "PATCH") && len(r.Body) > 0 || len(r.FormFilePath) > 0 || len(r.FormData) > 0 || len(r.FormFile) > 0 {
+	if r.digest != nil {
+		password := redacted
+		if r.showSecrets {
+			password = r.digest.password
+		}
+		curlCommand.WriteString(" --digest -u ")
+		curlCommand.WriteString(shellQuote(r.digest.username + ":" + password))
+	}
+
+	if (r.Method == "POST" || r.Method == "PUT" || r.Method == "PATCH") && (len(r.Body) > 0 || r.bodyStream) || r.hasFormData() {
 		contentType := r.Headers.Get("Content-Type")
 		if strings.Contains(contentType, "multipart/form-data") {
-			for key, filePath := range r.FormFilePath {
+			for _, key := range sortedKeys(r.FormFilePath) {
 				curlCommand.WriteString(" -F \"")
 				curlCommand.WriteString(key)
 				curlCommand.WriteString("=@")
-				curlCommand.WriteString(filePath)
+				curlCommand.WriteString(r.FormFilePath[key])
 				curlCommand.WriteString("\"")
 			}
 
-			for key, value := range r.FormData {
+			for _, key := range sortedKeys(r.FormData) {
 				curlCommand.WriteString(" -F \"")
 				curlCommand.WriteString(key)
 				curlCommand.WriteString("=")
-				curlCommand.WriteString(value)
+				curlCommand.WriteString(r.FormData[key])
 				curlCommand.WriteString("\"")
 			}
 
-			for fieldname, file := range r.FormFile {
+			for _, fieldname := range sortedKeys(r.FormFile) {
+				file := r.FormFile[fieldname]
 				namedFile, ok := file.(NamedFile)
 				if !ok {
 					return ""
@@ -435,12 +363,31 @@ func (r *Request) GenerateCurlCommand() string {
 				curlCommand.WriteString(namedFile.Name())
 				curlCommand.WriteString("\"")
 			}
+
+			for _, p := range r.parts {
+				curlCommand.WriteString(" -F ")
+				curlCommand.WriteString(shellQuote(p.curlForm()))
+			}
+		} else if r.bodyStream || !utf8.Valid(r.Body) {
+			curlCommand.WriteString(" --data-binary @-")
+		} else if strings.Contains(contentType, "ndjson") {
+			curlCommand.WriteString(" --data-binary ")
+			curlCommand.WriteString(shellQuote(string(r.Body)))
 		} else {
-			curlCommand.WriteString(" --data-raw '")
-			curlCommand.WriteString(string(r.Body))
-			curlCommand.WriteString("'")
+			curlCommand.WriteString(" --data-raw ")
+			curlCommand.WriteString(shellQuote(string(r.Body)))
 		}
 	}
 
+	if r.outputFile != "" {
+		curlCommand.WriteString(" -o \"")
+		curlCommand.WriteString(r.outputFile)
+		curlCommand.WriteString("\"")
+	}
+
 	return curlCommand.String()
 }
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
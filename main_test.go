@@ -233,7 +233,7 @@ func TestWriteFormData(t *testing.T) {
 	bodyBuffer := &bytes.Buffer{}
 	writer := multipart.NewWriter(bodyBuffer)
 
-	err = client.writeFormData(writer)
+	err = client.R().writeFormData(writer)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -0,0 +1,80 @@
+package vortex
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+)
+
+// RoundTripMiddleware wraps the transport a request is sent through. It can
+// change the outgoing request, inspect or replace the real response, return
+// a canned response without calling next, and see transport errors as
+// errors.
+type RoundTripMiddleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts an ordinary function to http.RoundTripper.
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// UseRoundTripper adds middleware to the transport chain. Middleware runs in
+// the order it was added, the first one being the outermost.
+func (c *Client) UseRoundTripper(middleware ...RoundTripMiddleware) *Client {
+	c.middleware = append(c.middleware, middleware...)
+	return c
+}
+
+// RoundTripMiddleware adapts a handler-style Middleware to the transport
+// chain. The handler passed to it as next sends the request and writes the
+// status code and headers of the real response; the response body is left
+// untouched. If the middleware never calls next, whatever it wrote is
+// returned as the response.
+func (m Middleware) RoundTripMiddleware() RoundTripMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			var resp *http.Response
+			var err error
+			called := false
+
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				resp, err = next.RoundTrip(r)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				for key, values := range resp.Header {
+					w.Header()[key] = values
+				}
+				w.Header().Set("StatusCode", strconv.Itoa(resp.StatusCode))
+				w.WriteHeader(resp.StatusCode)
+			}
+
+			recorder := httptest.NewRecorder()
+			m(req, handler)(recorder, req)
+
+			if called {
+				return resp, err
+			}
+
+			resp = recorder.Result()
+			resp.Request = req
+			return resp, nil
+		})
+	}
+}
+
+func chainRoundTrippers(transport http.RoundTripper, middleware []RoundTripMiddleware) http.RoundTripper {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		transport = middleware[i](transport)
+	}
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := transport.RoundTrip(req)
+		if resp != nil && resp.Request == nil {
+			resp.Request = req
+		}
+		return resp, err
+	})
+}
@@ -0,0 +1,202 @@
+package vortex
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRoundTripMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Server", "vortex")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(r.Header.Get("X-Test")))
+	}))
+	defer server.Close()
+
+	var seenStatus int
+	var seenHeader string
+	client := New(Opt{BaseURL: server.URL})
+	client.UseRoundTripper(func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req.Header.Set("X-Test", "round-tripper")
+			resp, err := next.RoundTrip(req)
+			if err != nil {
+				return nil, err
+			}
+			seenStatus = resp.StatusCode
+			seenHeader = resp.Header.Get("X-Server")
+			return resp, nil
+		})
+	})
+
+	resp, err := client.Get("/test")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(resp.Body) != "round-tripper" {
+		t.Errorf("expected body to be round-tripper, got %s", string(resp.Body))
+	}
+	if seenStatus != http.StatusAccepted {
+		t.Errorf("expected middleware to see status code 202, got %d", seenStatus)
+	}
+	if seenHeader != "vortex" {
+		t.Errorf("expected middleware to see X-Server header vortex, got %s", seenHeader)
+	}
+}
+
+func TestRoundTripMiddlewareOrder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Join(r.Header.Values("X-Order"), ",")))
+	}))
+	defer server.Close()
+
+	order := func(name string) RoundTripMiddleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				req.Header.Add("X-Order", name)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+
+	client := New(Opt{BaseURL: server.URL})
+	client.UseRoundTripper(order("first"), order("second"))
+	client.UseMiddleware(func(req *http.Request, next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Add("X-Order", "third")
+			next(w, r)
+		}
+	})
+
+	resp, err := client.Get("/test")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(resp.Body) != "first,second,third" {
+		t.Errorf("expected middleware to run in order first,second,third, got %s", string(resp.Body))
+	}
+}
+
+func TestRoundTripMiddlewareShortCircuit(t *testing.T) {
+	client := New(Opt{BaseURL: "http://example.invalid"})
+	client.UseRoundTripper(func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusAccepted,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(`{"message": "cached"}`)),
+			}, nil
+		})
+	})
+
+	var output struct {
+		Message string `json:"message"`
+	}
+	resp, err := client.R().SetOutput(&output).Get("/test")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("expected status code 202, got %d", resp.StatusCode)
+	}
+	if output.Message != "cached" {
+		t.Errorf("expected message to be cached, got %s", output.Message)
+	}
+}
+
+func TestRoundTripMiddlewareSeesTransportErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+
+	var seenErr error
+	client := New(Opt{BaseURL: server.URL})
+	client.UseRoundTripper(func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.RoundTrip(req)
+			seenErr = err
+			return resp, err
+		})
+	})
+
+	resp, err := client.Get("/test")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if resp != nil {
+		t.Errorf("expected no response, got %+v", resp)
+	}
+	if seenErr == nil {
+		t.Errorf("expected middleware to see the transport error")
+	}
+}
+
+func TestRoundTripMiddlewareError(t *testing.T) {
+	errDenied := errors.New("denied")
+	client := New(Opt{BaseURL: "http://example.invalid"})
+	client.UseRoundTripper(func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return nil, errDenied
+		})
+	})
+
+	_, err := client.Get("/test")
+	if !errors.Is(err, errDenied) {
+		t.Errorf("expected error to wrap denied, got %v", err)
+	}
+}
+
+func TestMiddlewareAdapterSeesRealResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Server", "vortex")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`not found`))
+	}))
+	defer server.Close()
+
+	var statusCode, serverHeader string
+	client := New(Opt{BaseURL: server.URL})
+	client.UseMiddleware(func(req *http.Request, next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			next(w, r)
+			statusCode = w.Header().Get("StatusCode")
+			serverHeader = w.Header().Get("X-Server")
+		}
+	})
+
+	resp, err := client.Get("/test")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.StatusCode != http.StatusNotFound || string(resp.Body) != "not found" {
+		t.Errorf("expected 404 not found, got %d %s", resp.StatusCode, string(resp.Body))
+	}
+	if statusCode != "404" {
+		t.Errorf("expected StatusCode header to be 404, got %s", statusCode)
+	}
+	if serverHeader != "vortex" {
+		t.Errorf("expected X-Server header to be vortex, got %s", serverHeader)
+	}
+}
+
+func TestMiddlewareAdapterShortCircuit(t *testing.T) {
+	client := New(Opt{BaseURL: "http://example.invalid"})
+	client.UseMiddleware(func(req *http.Request, next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Cache", "hit")
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`cached`))
+		}
+	})
+
+	resp, err := client.Get("/test")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || string(resp.Body) != "cached" {
+		t.Errorf("expected 200 cached, got %d %s", resp.StatusCode, string(resp.Body))
+	}
+}
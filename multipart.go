@@ -0,0 +1,489 @@
+package vortex
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FormPart describes one part of a multipart body. Leave FileName empty for
+// a plain field. When ContentType is empty it is guessed for files from the
+// file name extension, then from the first bytes of the content.
+type FormPart struct {
+	Name        string
+	FileName    string
+	ContentType string
+	Header      http.Header
+	Reader      io.Reader
+}
+
+// formPart is one part of a multipart body: value is sent when open is nil,
+// the content returned by open otherwise.
+type formPart struct {
+	field       string
+	filename    string
+	value       string
+	contentType string
+	header      http.Header
+	open        func() (io.Reader, error)
+	size        int64
+	reusable    bool
+	source      string
+	jsonValue   interface{}
+	fsys        fs.FS
+	err         error
+}
+
+// AddFormField appends a plain field. Unlike SetFormData it keeps every
+// value, so the same name can be sent more than once.
+func (r *Request) AddFormField(name, value string) *Request {
+	r.parts = append(r.parts, formPart{field: name, value: value})
+	return r
+}
+
+// AddFormFileReader appends a file part read from reader.
+func (r *Request) AddFormFileReader(name, filename string, reader io.Reader) *Request {
+	return r.AddFormPart(FormPart{Name: name, FileName: filename, Reader: reader})
+}
+
+// AddFormFileFS appends a file part read from fsys, such as an embed.FS.
+func (r *Request) AddFormFileFS(name string, fsys fs.FS, filePath string) *Request {
+	r.parts = append(r.parts, formPart{
+		field:    name,
+		filename: path.Base(filePath),
+		source:   filePath,
+		fsys:     fsys,
+	})
+	return r
+}
+
+// AddFormJSON appends a field holding v encoded as JSON.
+func (r *Request) AddFormJSON(name string, v interface{}) *Request {
+	r.parts = append(r.parts, formPart{
+		field:       name,
+		contentType: "application/json",
+		jsonValue:   v,
+	})
+	return r
+}
+
+// AddFormPart appends part as it is described.
+func (r *Request) AddFormPart(part FormPart) *Request {
+	p := formPart{
+		field:       part.Name,
+		filename:    part.FileName,
+		contentType: part.ContentType,
+		header:      part.Header,
+		source:      part.FileName,
+	}
+	if part.Reader == nil {
+		p.err = fmt.Errorf("vortex: form part %s has no reader", part.Name)
+	} else {
+		p.open, p.size, p.reusable, p.err = readerSource(part.Reader)
+	}
+	r.parts = append(r.parts, p)
+	return r
+}
+
+// formParts collects the parts set with SetFormFilePath, SetFormData and
+// SetFormFile, each sorted by name, followed by the added parts in order.
+// Files are not read here, only opened on demand.
+func (r *Request) formParts() ([]formPart, error) {
+	var parts []formPart
+
+	for _, key := range sortedKeys(r.FormFilePath) {
+		filePath := r.FormFilePath[key]
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, formPart{
+			field:    key,
+			filename: filepath.Base(filePath),
+			open: func() (io.Reader, error) {
+				return os.Open(filePath)
+			},
+			size:     info.Size(),
+			reusable: true,
+		})
+	}
+
+	for _, key := range sortedKeys(r.FormData) {
+		parts = append(parts, formPart{field: key, value: r.FormData[key]})
+	}
+
+	for _, fieldname := range sortedKeys(r.FormFile) {
+		file := r.FormFile[fieldname]
+		namedFile, ok := file.(NamedFile)
+		if !ok {
+			return nil, fmt.Errorf("form file %s has no name", fieldname)
+		}
+		open, size, reusable, err := readerSource(file)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, formPart{
+			field:    fieldname,
+			filename: namedFile.Name(),
+			open:     open,
+			size:     size,
+			reusable: reusable,
+		})
+	}
+
+	for _, p := range r.parts {
+		if err := p.resolve(); err != nil {
+			return nil, err
+		}
+		parts = append(parts, p)
+	}
+
+	for i := range parts {
+		if err := parts[i].sniff(); err != nil {
+			return nil, err
+		}
+	}
+	return parts, nil
+}
+
+// resolve turns a lazily described part into one that can be written.
+func (p *formPart) resolve() error {
+	if p.err != nil {
+		return p.err
+	}
+	if p.jsonValue != nil {
+		data, err := json.Marshal(p.jsonValue)
+		if err != nil {
+			return err
+		}
+		p.value = string(data)
+	}
+	if p.fsys != nil {
+		info, err := fs.Stat(p.fsys, p.source)
+		if err != nil {
+			return err
+		}
+		fsys, name := p.fsys, p.source
+		p.open = func() (io.Reader, error) {
+			return fsys.Open(name)
+		}
+		p.size = info.Size()
+		p.reusable = true
+	}
+	return nil
+}
+
+// sniff fills in the Content-Type of a file part from its extension or,
+// failing that, from the first 512 bytes of its content.
+func (p *formPart) sniff() error {
+	if p.contentType != "" || p.filename == "" || p.open == nil {
+		return nil
+	}
+	if contentType := mime.TypeByExtension(path.Ext(p.filename)); contentType != "" {
+		p.contentType = contentType
+		return nil
+	}
+
+	source, err := p.open()
+	if err != nil {
+		return err
+	}
+	head := make([]byte, 512)
+	n, err := io.ReadFull(source, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	head = head[:n]
+	p.contentType = http.DetectContentType(head)
+
+	if p.reusable {
+		if closer, ok := source.(io.Closer); ok {
+			closer.Close()
+		}
+		return nil
+	}
+	p.open = func() (io.Reader, error) {
+		return io.MultiReader(bytes.NewReader(head), source), nil
+	}
+	return nil
+}
+
+// readerSource returns how to read reader as a part. Seekable readers are
+// read from their current offset on every open and can be sent again on a
+// retry, each open getting its own io.SectionReader when reader is also an
+// io.ReaderAt; other readers can be read once.
+func readerSource(reader io.Reader) (open func() (io.Reader, error), size int64, reusable bool, err error) {
+	if seeker, ok := reader.(io.Seeker); ok {
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		end, err := seeker.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+			return nil, 0, false, err
+		}
+		if readerAt, ok := reader.(io.ReaderAt); ok {
+			open = func() (io.Reader, error) {
+				return io.NewSectionReader(readerAt, offset, end-offset), nil
+			}
+			return open, end - offset, true, nil
+		}
+		open = func() (io.Reader, error) {
+			_, err := seeker.Seek(offset, io.SeekStart)
+			return io.NopCloser(reader), err
+		}
+		return open, end - offset, true, nil
+	}
+
+	size = -1
+	if sized, ok := reader.(interface{ Len() int }); ok {
+		size = int64(sized.Len())
+	}
+	open = func() (io.Reader, error) {
+		return reader, nil
+	}
+	return open, size, false, nil
+}
+
+func (r *Request) writeFormData(writer *multipart.Writer) error {
+	parts, err := r.formParts()
+	if err != nil {
+		return err
+	}
+	return writeFormParts(writer, parts)
+}
+
+func writeFormParts(writer *multipart.Writer, parts []formPart) error {
+	for _, p := range parts {
+		if err := writeFormPart(writer, p); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+func writeFormPart(writer *multipart.Writer, p formPart) error {
+	part, err := writer.CreatePart(p.mimeHeader())
+	if err != nil {
+		return err
+	}
+	if p.open == nil {
+		_, err := io.WriteString(part, p.value)
+		return err
+	}
+
+	source, err := p.open()
+	if err != nil {
+		return err
+	}
+	if closer, ok := source.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if _, err := io.Copy(part, source); err != nil {
+		return fmt.Errorf("vortex: reading form file %s: %w", p.filename, err)
+	}
+	return nil
+}
+
+// curlForm renders the part as the argument of a curl -F option.
+func (p formPart) curlForm() string {
+	value := p.value
+	if p.jsonValue != nil {
+		data, _ := json.Marshal(p.jsonValue)
+		value = string(data)
+	}
+
+	form := p.field + "=" + value
+	if p.filename != "" {
+		form = p.field + "=@" + p.source
+		if path.Base(p.source) != p.filename {
+			form += ";filename=" + p.filename
+		}
+	}
+	if p.contentType != "" {
+		form += ";type=" + p.contentType
+	}
+	return form
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func (p formPart) mimeHeader() textproto.MIMEHeader {
+	header := textproto.MIMEHeader{}
+	for key, values := range p.header {
+		header[textproto.CanonicalMIMEHeaderKey(key)] = values
+	}
+
+	disposition := fmt.Sprintf(`form-data; name="%s"`, quoteEscaper.Replace(p.field))
+	if p.filename != "" {
+		disposition += fmt.Sprintf(`; filename="%s"`, quoteEscaper.Replace(p.filename))
+	}
+	header.Set("Content-Disposition", disposition)
+	if p.contentType != "" {
+		header.Set("Content-Type", p.contentType)
+	}
+	return header
+}
+
+// multipartBody streams a multipart body through a pipe, so files are read
+// as the request is sent instead of being buffered in memory.
+type multipartBody struct {
+	parts    []formPart
+	boundary string
+	// writing is held while a body is written, so that a retry does not
+	// rewind a reader the previous attempt is still copying from.
+	writing sync.Mutex
+}
+
+func newMultipartBody(parts []formPart) *multipartBody {
+	return &multipartBody{
+		parts:    parts,
+		boundary: multipart.NewWriter(io.Discard).Boundary(),
+	}
+}
+
+func (b *multipartBody) contentType() string {
+	return "multipart/form-data; boundary=" + b.boundary
+}
+
+// reusable reports whether the body can be produced again, e.g. for a retry.
+func (b *multipartBody) reusable() bool {
+	for _, p := range b.parts {
+		if p.open != nil && !p.reusable {
+			return false
+		}
+	}
+	return true
+}
+
+// length returns the size of the encoded body, or -1 when the size of a
+// part is unknown.
+func (b *multipartBody) length() int64 {
+	var counter countingWriter
+	writer := multipart.NewWriter(&counter)
+	if err := writer.SetBoundary(b.boundary); err != nil {
+		return -1
+	}
+
+	var files int64
+	for _, p := range b.parts {
+		if p.open != nil && p.size < 0 {
+			return -1
+		}
+		part, err := writer.CreatePart(p.mimeHeader())
+		if err != nil {
+			return -1
+		}
+		if p.open == nil {
+			io.WriteString(part, p.value)
+			continue
+		}
+		files += p.size
+	}
+	if err := writer.Close(); err != nil {
+		return -1
+	}
+	return counter.n + files
+}
+
+// reader returns a fresh body. The first Read starts a goroutine writing
+// the parts into a pipe, so a body that is never sent leaves nothing
+// running; a read error on a file is returned to the transport.
+func (b *multipartBody) reader() io.ReadCloser {
+	return &multipartReader{body: b}
+}
+
+type multipartReader struct {
+	body *multipartBody
+
+	mu     sync.Mutex
+	pipe   *io.PipeReader
+	closed bool
+}
+
+func (r *multipartReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return 0, io.ErrClosedPipe
+	}
+	if r.pipe == nil {
+		r.pipe = r.body.start()
+	}
+	pipe := r.pipe
+	r.mu.Unlock()
+	return pipe.Read(p)
+}
+
+func (r *multipartReader) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	pipe := r.pipe
+	r.mu.Unlock()
+	if pipe != nil {
+		return pipe.Close()
+	}
+	return nil
+}
+
+func (b *multipartBody) start() *io.PipeReader {
+	pr, pw := io.Pipe()
+	go func() {
+		b.writing.Lock()
+		defer b.writing.Unlock()
+		writer := multipart.NewWriter(pw)
+		err := writer.SetBoundary(b.boundary)
+		if err == nil {
+			err = writeFormParts(writer, b.parts)
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Chunked sends multipart bodies with chunked transfer encoding instead of
+// a precomputed Content-Length.
+func (c *Client) Chunked() *Client {
+	c.chunked = true
+	return c
+}
+
+// Chunked sends the multipart body of this request with chunked transfer
+// encoding instead of a precomputed Content-Length.
+func (r *Request) Chunked() *Request {
+	r.chunked = true
+	return r
+}
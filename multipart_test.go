@@ -0,0 +1,351 @@
+package vortex
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+)
+
+// failingFile is a NamedFile whose reads fail once failAt bytes were read.
+type failingFile struct {
+	reader *strings.Reader
+	failAt int64
+	err    error
+}
+
+func (f *failingFile) Read(p []byte) (int, error) {
+	offset, _ := f.reader.Seek(0, io.SeekCurrent)
+	if offset >= f.failAt {
+		return 0, f.err
+	}
+	if remaining := f.failAt - offset; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	return f.reader.Read(p)
+}
+
+func (f *failingFile) ReadAt(p []byte, off int64) (int, error) { return 0, f.err }
+func (f *failingFile) Seek(offset int64, whence int) (int64, error) {
+	return f.reader.Seek(offset, whence)
+}
+func (f *failingFile) Close() error { return nil }
+func (f *failingFile) Name() string { return "broken.bin" }
+
+func newMultipartServer(t *testing.T, check func(r *http.Request)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		check(r)
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		content, _ := io.ReadAll(file)
+		w.Write([]byte(r.FormValue("field") + ":" + string(content)))
+	}))
+}
+
+func writeTempFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "upload.txt")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMultipartContentLength(t *testing.T) {
+	var contentLength int64
+	var transferEncoding []string
+	server := newMultipartServer(t, func(r *http.Request) {
+		contentLength = r.ContentLength
+		transferEncoding = r.TransferEncoding
+	})
+	defer server.Close()
+
+	resp, err := New(Opt{BaseURL: server.URL}).R().
+		SetFormFilePath("file", writeTempFile(t, strings.Repeat("x", 100000))).
+		SetFormData(map[string]string{"field": "value"}).
+		Post("/upload", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(resp.Body) != "value:"+strings.Repeat("x", 100000) {
+		t.Fatalf("expected the server to receive the file, got %d %.40s", resp.StatusCode, string(resp.Body))
+	}
+	if contentLength <= 100000 {
+		t.Errorf("expected Content-Length to cover the file, got %d", contentLength)
+	}
+	if len(transferEncoding) != 0 {
+		t.Errorf("expected no transfer encoding, got %v", transferEncoding)
+	}
+}
+
+func TestMultipartChunked(t *testing.T) {
+	var contentLength int64
+	var transferEncoding []string
+	server := newMultipartServer(t, func(r *http.Request) {
+		contentLength = r.ContentLength
+		transferEncoding = r.TransferEncoding
+	})
+	defer server.Close()
+
+	resp, err := New(Opt{BaseURL: server.URL}).Chunked().R().
+		SetFormFilePath("file", writeTempFile(t, "hello")).
+		Post("/upload", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(resp.Body) != ":hello" {
+		t.Errorf("expected the server to receive the file, got %s", string(resp.Body))
+	}
+	if contentLength != -1 || len(transferEncoding) != 1 || transferEncoding[0] != "chunked" {
+		t.Errorf("expected a chunked body, got length %d and encoding %v", contentLength, transferEncoding)
+	}
+}
+
+func TestMultipartFileFailsPartway(t *testing.T) {
+	server := newMultipartServer(t, func(r *http.Request) {})
+	defer server.Close()
+
+	errDisk := errors.New("disk removed")
+	file := &failingFile{reader: strings.NewReader(strings.Repeat("x", 100000)), failAt: 50000, err: errDisk}
+
+	resp, err := New(Opt{BaseURL: server.URL}).R().
+		SetFormFile("file", file).
+		Post("/upload", nil)
+	if !errors.Is(err, errDisk) {
+		t.Fatalf("expected the read error, got %v", err)
+	}
+	var transportErr *TransportError
+	if !errors.As(err, &transportErr) {
+		t.Errorf("expected a *TransportError, got %v", err)
+	}
+	if resp != nil {
+		t.Errorf("expected no response, got %+v", resp)
+	}
+}
+
+func TestMultipartNotSent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 20; i++ {
+		file, err := os.Open(writeTempFile(t, "payload"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = New(Opt{BaseURL: "http://127.0.0.1:1"}).R().
+			SetContext(ctx).
+			SetFormFile("file", file).
+			SetFormFilePath("path", writeTempFile(t, "payload")).
+			Post("/upload", nil)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+		if _, err := file.Read(make([]byte, 1)); !errors.Is(err, os.ErrClosed) {
+			t.Errorf("expected the form file to be closed, got %v", err)
+		}
+	}
+	if after := runtime.NumGoroutine(); after > before+5 {
+		t.Errorf("expected no multipart writers left running, got %d goroutines, had %d", after, before)
+	}
+}
+
+func TestMultipartRetryResendsBody(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		content, _ := io.ReadAll(file)
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	resp, err := New(Opt{BaseURL: server.URL, Retries: 1}).
+		SetRetryWaitTime(0, 0).
+		RetryNonIdempotent().
+		R().
+		SetFormFilePath("file", writeTempFile(t, "again")).
+		Post("/upload", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || string(resp.Body) != "again" {
+		t.Errorf("expected the retried upload to carry the file, got %d %s", resp.StatusCode, string(resp.Body))
+	}
+}
+
+type receivedPart struct {
+	name, filename, contentType, header, content string
+}
+
+func newPartsServer(t *testing.T, received *[]receivedPart) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader, err := r.MultipartReader()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			content, _ := io.ReadAll(part)
+			*received = append(*received, receivedPart{
+				name:        part.FormName(),
+				filename:    part.FileName(),
+				contentType: part.Header.Get("Content-Type"),
+				header:      part.Header.Get("X-Part"),
+				content:     string(content),
+			})
+		}
+	}))
+}
+
+func TestMultipartRetrySeekableReader(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 256<<10)
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received, _ := io.ReadAll(file)
+		if !bytes.Equal(received, content) {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	client := New(Opt{BaseURL: server.URL, Retries: 1}).SetRetryWaitTime(0, 0)
+	readers := map[string]io.Reader{
+		"io.ReaderAt": bytes.NewReader(content),
+		"io.Seeker":   struct{ io.ReadSeeker }{bytes.NewReader(content)},
+	}
+	for name, reader := range readers {
+		resp, err := client.R().AddFormFileReader("file", "data.bin", reader).Put("/upload", nil)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: expected the retried upload to carry the whole file, got %v, %v", name, resp, err)
+		}
+	}
+}
+
+func TestMultipartOrderedParts(t *testing.T) {
+	var received []receivedPart
+	server := newPartsServer(t, &received)
+	defer server.Close()
+
+	png := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 16)
+	files := fstest.MapFS{"assets/logo.svg": {Data: []byte("<svg/>")}}
+
+	_, err := New(Opt{BaseURL: server.URL}).R().
+		AddFormField("tags[]", "a").
+		AddFormField("tags[]", "b").
+		AddFormFileReader("files[]", "image", strings.NewReader(png)).
+		AddFormFileReader("files[]", "notes.txt", strings.NewReader("notes")).
+		AddFormFileFS("logo", files, "assets/logo.svg").
+		AddFormJSON("meta", map[string]int{"version": 2}).
+		AddFormPart(FormPart{
+			Name:        "raw",
+			FileName:    "data.bin",
+			ContentType: "application/x-custom",
+			Header:      http.Header{"X-Part": {"custom"}},
+			Reader:      bytes.NewBufferString("raw"),
+		}).
+		Post("/upload", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := []receivedPart{
+		{"tags[]", "", "", "", "a"},
+		{"tags[]", "", "", "", "b"},
+		{"files[]", "image", "image/png", "", png},
+		{"files[]", "notes.txt", "text/plain; charset=utf-8", "", "notes"},
+		{"logo", "logo.svg", "image/svg+xml", "", "<svg/>"},
+		{"meta", "", "application/json", "", `{"version":2}`},
+		{"raw", "data.bin", "application/x-custom", "custom", "raw"},
+	}
+	if len(received) != len(expected) {
+		t.Fatalf("expected %d parts, got %+v", len(expected), received)
+	}
+	for i := range expected {
+		if received[i] != expected[i] {
+			t.Errorf("expected part %d to be %+v, got %+v", i, expected[i], received[i])
+		}
+	}
+}
+
+func TestMultipartSortedFormMaps(t *testing.T) {
+	var received []receivedPart
+	server := newPartsServer(t, &received)
+	defer server.Close()
+
+	_, err := New(Opt{BaseURL: server.URL}).R().
+		SetFormData(map[string]string{"c": "3", "a": "1", "b": "2"}).
+		AddFormField("d", "4").
+		Post("/upload", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var names []string
+	for _, part := range received {
+		names = append(names, part.name)
+	}
+	if strings.Join(names, ",") != "a,b,c,d" {
+		t.Errorf("expected parts in order a,b,c,d, got %v", names)
+	}
+}
+
+func TestMultipartPartsCurlCommand(t *testing.T) {
+	server := newPartsServer(t, &[]receivedPart{})
+	defer server.Close()
+
+	resp, err := New(Opt{BaseURL: server.URL}).R().
+		AddFormField("tags[]", "a").
+		AddFormFileFS("logo", fstest.MapFS{"assets/logo.svg": {Data: []byte("<svg/>")}}, "assets/logo.svg").
+		AddFormJSON("meta", map[string]int{"version": 2}).
+		Post("/upload", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := ` -F 'tags[]=a' -F 'logo=@assets/logo.svg' -F 'meta={"version":2};type=application/json'`
+	if curl := resp.Request.GenerateCurlCommand(); !strings.HasSuffix(curl, expected) {
+		t.Errorf("expected curl command to end with %s, got %s", expected, curl)
+	}
+}
@@ -0,0 +1,326 @@
+package vortex
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultEarlyExpiry is how long before its expiry a token is renewed.
+	defaultEarlyExpiry = 10 * time.Second
+	// defaultTokenTimeout limits the token requests of the default client.
+	defaultTokenTimeout = 30 * time.Second
+)
+
+// Token is an access token sent in the Authorization header.
+type Token struct {
+	AccessToken string
+	// TokenType is the authorization scheme, "Bearer" when empty.
+	TokenType    string
+	RefreshToken string
+	// Expiry is when the token expires. A zero Expiry never expires.
+	Expiry time.Time
+}
+
+func (t *Token) authorization() string {
+	tokenType := t.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	return tokenType + " " + t.AccessToken
+}
+
+// TokenSource supplies the token for each request. A source that also has
+// an Invalidate(*Token) method is told when the server rejects a token with
+// 401, and the request is sent once more with a fresh token.
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// SetTokenSource authenticates every request with a token from source.
+func (c *Client) SetTokenSource(source TokenSource) *Client {
+	c.tokenSource = source
+	return c
+}
+
+func (r *Request) SetTokenSource(source TokenSource) *Request {
+	r.tokenSource = source
+	return r
+}
+
+// tokenTransport sets the Authorization header from a TokenSource and
+// retries once with a fresh token when the server answers 401.
+type tokenTransport struct {
+	next   http.RoundTripper
+	source TokenSource
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Context().Value(tokenFetchKey{}) != nil {
+		return t.next.RoundTrip(req)
+	}
+	token, err := t.source.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(withHeader(req, "Authorization", token.authorization()))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	invalidator, ok := t.source.(interface{ Invalidate(*Token) })
+	if !ok || req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+	invalidator.Invalidate(token)
+	fresh, err := t.source.Token(req.Context())
+	if err != nil || fresh.AccessToken == token.AccessToken {
+		return resp, nil
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		retry.Body = body
+	}
+	retry.Header.Set("Authorization", fresh.authorization())
+	return t.next.RoundTrip(retry)
+}
+
+// tokenCache keeps the current token and renews it through fetch. While a
+// renewal is running, other callers wait for its result instead of starting
+// their own. The renewal does not stop when the caller that started it
+// gives up while others still wait for it; once no caller is waiting it is
+// cancelled, and the next caller starts a new one.
+type tokenCache struct {
+	fetch       func(ctx context.Context, current *Token) (*Token, error)
+	clock       Clock
+	earlyExpiry time.Duration
+
+	mu       sync.Mutex
+	token    *Token
+	invalid  bool
+	inFlight *tokenFetch
+}
+
+// tokenFetchKey marks the context of a token renewal, whose own requests
+// must not wait for the token they are fetching.
+type tokenFetchKey struct{}
+
+type tokenFetch struct {
+	done    chan struct{}
+	token   *Token
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+func (c *tokenCache) Token(ctx context.Context) (*Token, error) {
+	c.mu.Lock()
+	if c.token != nil && !c.invalid && (c.token.Expiry.IsZero() || c.clock.Now().Add(c.earlyExpiry).Before(c.token.Expiry)) {
+		token := c.token
+		c.mu.Unlock()
+		return token, nil
+	}
+	f := c.inFlight
+	if f == nil {
+		fetchCtx, cancel := context.WithCancel(context.WithValue(valuesContext{ctx}, tokenFetchKey{}, true))
+		f = &tokenFetch{done: make(chan struct{}), cancel: cancel}
+		c.inFlight = f
+		go c.renew(f, fetchCtx, c.token)
+	}
+	f.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.token, f.err
+	case <-ctx.Done():
+		c.mu.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			f.cancel()
+			if c.inFlight == f {
+				c.inFlight = nil
+			}
+		}
+		c.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+func (c *tokenCache) renew(f *tokenFetch, ctx context.Context, current *Token) {
+	f.token, f.err = c.fetch(ctx, current)
+
+	c.mu.Lock()
+	if f.err == nil {
+		c.token = f.token
+		c.invalid = false
+	}
+	if c.inFlight == f {
+		c.inFlight = nil
+	}
+	c.mu.Unlock()
+	f.cancel()
+	close(f.done)
+}
+
+// valuesContext keeps the values of a context but not its deadline or
+// cancellation, which belong to the caller that started a renewal.
+type valuesContext struct {
+	context.Context
+}
+
+func (valuesContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (valuesContext) Done() <-chan struct{}       { return nil }
+func (valuesContext) Err() error                  { return nil }
+
+// Invalidate makes the next call renew the token, unless token has already
+// been replaced.
+func (c *tokenCache) Invalidate(token *Token) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == token {
+		c.invalid = true
+	}
+}
+
+// OAuth2Config configures an OAuth2TokenSource.
+type OAuth2Config struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// RefreshToken makes the source start with the refresh_token grant
+	// instead of client_credentials.
+	RefreshToken string
+	// ClientSecretInBody sends the client credentials as form parameters
+	// instead of HTTP Basic authentication.
+	ClientSecretInBody bool
+	// EarlyExpiry is how long before expiry a token is renewed, 10s by
+	// default.
+	EarlyExpiry time.Duration
+	// Client sends the token requests, a client with a 30s timeout by
+	// default.
+	Client *Client
+}
+
+// OAuth2TokenSource fetches tokens from an OAuth2 token endpoint with the
+// client_credentials grant, or the refresh_token grant once a refresh token
+// is known, and caches them until shortly before they expire.
+type OAuth2TokenSource struct {
+	*tokenCache
+	config OAuth2Config
+	client *Client
+}
+
+func NewOAuth2TokenSource(config OAuth2Config) *OAuth2TokenSource {
+	s := &OAuth2TokenSource{config: config, client: config.Client}
+	if s.client == nil {
+		s.client = New(Opt{Timeout: defaultTokenTimeout})
+	}
+	earlyExpiry := config.EarlyExpiry
+	if earlyExpiry == 0 {
+		earlyExpiry = defaultEarlyExpiry
+	}
+	s.tokenCache = &tokenCache{fetch: s.fetch, clock: realClock{}, earlyExpiry: earlyExpiry}
+	return s
+}
+
+// SetClock sets the clock used to tell when tokens expire.
+func (s *OAuth2TokenSource) SetClock(clock Clock) *OAuth2TokenSource {
+	s.clock = clock
+	return s
+}
+
+// OAuth2Error is the error response of a token endpoint.
+type OAuth2Error struct {
+	StatusCode  int
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+	URI         string `json:"error_uri"`
+}
+
+func (e *OAuth2Error) Error() string {
+	if e.Description == "" {
+		return fmt.Sprintf("vortex: oauth2: %d %s", e.StatusCode, e.Code)
+	}
+	return fmt.Sprintf("vortex: oauth2: %d %s: %s", e.StatusCode, e.Code, e.Description)
+}
+
+type oauth2TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+func (s *OAuth2TokenSource) fetch(ctx context.Context, current *Token) (*Token, error) {
+	refreshToken := s.config.RefreshToken
+	if current != nil && current.RefreshToken != "" {
+		refreshToken = current.RefreshToken
+	}
+	if refreshToken != "" {
+		token, err := s.request(ctx, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {refreshToken},
+		}, refreshToken)
+		if err == nil || s.config.RefreshToken != "" {
+			return token, err
+		}
+	}
+	return s.request(ctx, url.Values{"grant_type": {"client_credentials"}}, "")
+}
+
+// request posts a grant to the token endpoint. A response without a
+// refresh token keeps refreshToken.
+func (s *OAuth2TokenSource) request(ctx context.Context, params url.Values, refreshToken string) (*Token, error) {
+	if len(s.config.Scopes) > 0 {
+		params.Set("scope", strings.Join(s.config.Scopes, " "))
+	}
+	req := s.client.R().SetContext(ctx).SetHeader("Accept", "application/json")
+	if s.config.ClientSecretInBody {
+		params.Set("client_id", s.config.ClientID)
+		params.Set("client_secret", s.config.ClientSecret)
+	} else {
+		req.SetBasicAuth(url.QueryEscape(s.config.ClientID), url.QueryEscape(s.config.ClientSecret))
+	}
+
+	var body oauth2TokenResponse
+	var oauthErr OAuth2Error
+	resp, err := req.SetOutput(&body).SetError(&oauthErr).Post(s.config.TokenURL, params)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.IsSuccess() {
+		oauthErr.StatusCode = resp.StatusCode
+		return nil, &oauthErr
+	}
+	if body.AccessToken == "" {
+		return nil, fmt.Errorf("vortex: oauth2: token response has no access_token")
+	}
+
+	token := &Token{
+		AccessToken:  body.AccessToken,
+		TokenType:    body.TokenType,
+		RefreshToken: body.RefreshToken,
+	}
+	if token.RefreshToken == "" {
+		token.RefreshToken = refreshToken
+	}
+	if body.ExpiresIn > 0 {
+		token.Expiry = s.clock.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
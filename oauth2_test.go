@@ -0,0 +1,282 @@
+package vortex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tokenServer is an OAuth2 token endpoint that issues numbered tokens and
+// records the grants it was asked for.
+type tokenServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	grants []string
+	delay  time.Duration
+}
+
+func newTokenServer() *tokenServer {
+	s := &tokenServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if id, secret, ok := r.BasicAuth(); !ok || id != "service" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"invalid_client","error_description":"unknown client"}`)
+			return
+		}
+		r.ParseForm()
+		s.mu.Lock()
+		s.grants = append(s.grants, r.PostForm.Get("grant_type")+":"+r.PostForm.Get("refresh_token"))
+		n := len(s.grants)
+		s.mu.Unlock()
+
+		time.Sleep(s.delay)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  fmt.Sprintf("token-%d", n),
+			"token_type":    "bearer",
+			"expires_in":    60,
+			"refresh_token": fmt.Sprintf("refresh-%d", n),
+		})
+	}))
+	return s
+}
+
+func (s *tokenServer) Grants() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.grants...)
+}
+
+// newProtectedServer accepts requests whose bearer token accept allows.
+func newProtectedServer(accept func(token string) bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var token string
+		fmt.Sscanf(r.Header.Get("Authorization"), "Bearer %s", &token)
+		if !accept(token) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, token)
+	}))
+}
+
+func TestOAuth2ClientCredentials(t *testing.T) {
+	tokens := newTokenServer()
+	defer tokens.Close()
+	api := newProtectedServer(func(token string) bool { return token != "" })
+	defer api.Close()
+
+	clock := newFakeClock()
+	source := NewOAuth2TokenSource(OAuth2Config{
+		TokenURL:     tokens.URL,
+		ClientID:     "service",
+		ClientSecret: "s3cret",
+		Scopes:       []string{"orders:read"},
+	}).SetClock(clock)
+	client := New(Opt{BaseURL: api.URL}).SetTokenSource(source)
+
+	for _, expected := range []string{"token-1", "token-1"} {
+		resp, err := client.Get("/orders")
+		if err != nil || string(resp.Body) != expected {
+			t.Fatalf("expected the request to use %s, got %v, %v", expected, resp, err)
+		}
+	}
+
+	clock.After(55 * time.Second)
+	resp, err := client.Get("/orders")
+	if err != nil || string(resp.Body) != "token-2" {
+		t.Fatalf("expected the token to be refreshed before expiry, got %v, %v", resp, err)
+	}
+	if grants := fmt.Sprint(tokens.Grants()); grants != "[client_credentials: refresh_token:refresh-1]" {
+		t.Errorf("expected a client_credentials then a refresh_token grant, got %s", grants)
+	}
+}
+
+func TestOAuth2SingleFlight(t *testing.T) {
+	tokens := newTokenServer()
+	tokens.delay = 50 * time.Millisecond
+	defer tokens.Close()
+	api := newProtectedServer(func(token string) bool { return token == "token-1" })
+	defer api.Close()
+
+	client := New(Opt{BaseURL: api.URL}).SetTokenSource(NewOAuth2TokenSource(OAuth2Config{
+		TokenURL:     tokens.URL,
+		ClientID:     "service",
+		ClientSecret: "s3cret",
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if resp, err := client.Get("/orders"); err != nil || resp.StatusCode != http.StatusOK {
+				t.Errorf("expected the request to succeed, got %v, %v", resp, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if grants := tokens.Grants(); len(grants) != 1 {
+		t.Errorf("expected a single token request, got %v", grants)
+	}
+}
+
+func TestOAuth2SingleFlightCancelledCaller(t *testing.T) {
+	tokens := newTokenServer()
+	tokens.delay = 100 * time.Millisecond
+	defer tokens.Close()
+
+	source := NewOAuth2TokenSource(OAuth2Config{
+		TokenURL:     tokens.URL,
+		ClientID:     "service",
+		ClientSecret: "s3cret",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := source.Token(ctx)
+		first <- err
+	}()
+	for len(tokens.Grants()) == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	second := make(chan *Token, 1)
+	go func() {
+		token, err := source.Token(context.Background())
+		if err != nil {
+			t.Errorf("expected the waiting caller to get a token, got %v", err)
+		}
+		second <- token
+	}()
+	for waiters := 0; waiters < 2; {
+		time.Sleep(time.Millisecond)
+		source.mu.Lock()
+		if source.inFlight != nil {
+			waiters = source.inFlight.waiters
+		}
+		source.mu.Unlock()
+	}
+	cancel()
+
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the cancelled caller to get context.Canceled, got %v", err)
+	}
+	if token := <-second; token == nil || token.AccessToken != "token-1" {
+		t.Errorf("expected the renewal to finish for the waiting caller, got %+v", token)
+	}
+	if grants := tokens.Grants(); len(grants) != 1 {
+		t.Errorf("expected a single token request, got %v", grants)
+	}
+}
+
+func TestTokenRenewalCancelledWithoutWaiters(t *testing.T) {
+	var mu sync.Mutex
+	fetches := 0
+	cache := &tokenCache{
+		fetch: func(ctx context.Context, current *Token) (*Token, error) {
+			mu.Lock()
+			fetches++
+			n := fetches
+			mu.Unlock()
+			if n == 1 {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return &Token{AccessToken: "fresh"}, nil
+		},
+		clock: realClock{},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := cache.Token(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the first caller to time out, got %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	token, err := cache.Token(ctx)
+	if err != nil || token.AccessToken != "fresh" {
+		t.Errorf("expected a new renewal once nobody waits for the hung one, got %+v, %v", token, err)
+	}
+}
+
+func TestOAuth2SharedClient(t *testing.T) {
+	tokens := newTokenServer()
+	defer tokens.Close()
+	api := newProtectedServer(func(token string) bool { return token == "token-1" })
+	defer api.Close()
+
+	client := New(Opt{})
+	client.SetTokenSource(NewOAuth2TokenSource(OAuth2Config{
+		TokenURL:     tokens.URL,
+		ClientID:     "service",
+		ClientSecret: "s3cret",
+		Client:       client,
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	resp, err := client.R().SetContext(ctx).Get(api.URL)
+	if err != nil || string(resp.Body) != "token-1" {
+		t.Errorf("expected the token request to skip its own token source, got %v, %v", resp, err)
+	}
+}
+
+func TestOAuth2RetriesUnauthorized(t *testing.T) {
+	tokens := newTokenServer()
+	defer tokens.Close()
+	var mu sync.Mutex
+	var seen []string
+	api := newProtectedServer(func(token string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		seen = append(seen, token)
+		return token != "token-1"
+	})
+	defer api.Close()
+
+	resp, err := New(Opt{BaseURL: api.URL}).
+		SetTokenSource(NewOAuth2TokenSource(OAuth2Config{
+			TokenURL:     tokens.URL,
+			ClientID:     "service",
+			ClientSecret: "s3cret",
+		})).
+		Post("/orders", map[string]string{"id": "1"})
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the request to be retried with a fresh token, got %v, %v", resp, err)
+	}
+	if fmt.Sprint(seen) != "[token-1 token-2]" {
+		t.Errorf("expected one retry with the refreshed token, got %v", seen)
+	}
+}
+
+func TestOAuth2Error(t *testing.T) {
+	tokens := newTokenServer()
+	defer tokens.Close()
+
+	source := NewOAuth2TokenSource(OAuth2Config{
+		TokenURL:     tokens.URL,
+		ClientID:     "service",
+		ClientSecret: "wrong",
+	})
+	_, err := source.Token(context.Background())
+	var oauthErr *OAuth2Error
+	if !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_client" || oauthErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected an invalid_client *OAuth2Error, got %v", err)
+	}
+
+	_, err = New(Opt{BaseURL: tokens.URL}).SetTokenSource(source).Get("/")
+	if !errors.As(err, &oauthErr) {
+		t.Errorf("expected the request to fail with the token error, got %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package vortex
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Progress describes how much of a request or response body has been
+// transferred so far.
+type Progress struct {
+	// Transferred is the number of bytes read so far.
+	Transferred int64
+	// Total is the size of the body, or -1 when it is not known.
+	Total int64
+	// Rate is the average transfer rate in bytes per second.
+	Rate float64
+	// Elapsed is the time since the transfer started.
+	Elapsed time.Duration
+	// Done is set on the last report, once the body was read to the end.
+	Done bool
+}
+
+// Percent returns the completed share of the body between 0 and 100, or -1
+// when the total is unknown.
+func (p Progress) Percent() float64 {
+	if p.Total <= 0 {
+		return -1
+	}
+	return float64(p.Transferred) / float64(p.Total) * 100
+}
+
+// ProgressFunc receives progress reports. Upload reports are made from the
+// goroutine that writes the request, so they may run concurrently with the
+// caller.
+type ProgressFunc func(Progress)
+
+const defaultProgressInterval = 100 * time.Millisecond
+
+// progressConfig holds the progress callbacks of a client or request.
+type progressConfig struct {
+	upload   ProgressFunc
+	download ProgressFunc
+	interval time.Duration
+}
+
+// OnUploadProgress reports progress while request bodies are sent.
+func (c *Client) OnUploadProgress(fn ProgressFunc) *Client {
+	c.progress.upload = fn
+	return c
+}
+
+// OnDownloadProgress reports progress while response bodies are read.
+func (c *Client) OnDownloadProgress(fn ProgressFunc) *Client {
+	c.progress.download = fn
+	return c
+}
+
+// SetProgressInterval sets the minimum time between two progress reports.
+// The final report is always made. It defaults to 100ms.
+func (c *Client) SetProgressInterval(interval time.Duration) *Client {
+	c.progress.interval = interval
+	return c
+}
+
+func (r *Request) OnUploadProgress(fn ProgressFunc) *Request {
+	r.progress.upload = fn
+	return r
+}
+
+func (r *Request) OnDownloadProgress(fn ProgressFunc) *Request {
+	r.progress.download = fn
+	return r
+}
+
+func (r *Request) SetProgressInterval(interval time.Duration) *Request {
+	r.progress.interval = interval
+	return r
+}
+
+// trackUpload wraps the body of req, and the bodies GetBody returns for
+// retries, so that every attempt reports its upload progress.
+func (r *Request) trackUpload(req *http.Request) {
+	fn := r.progress.upload
+	if fn == nil || req.Body == nil || req.Body == http.NoBody {
+		return
+	}
+
+	total := req.ContentLength
+	if total <= 0 {
+		total = -1
+	}
+	req.Body = r.newProgressReader(req.Body, total, fn)
+	if getBody := req.GetBody; getBody != nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return r.newProgressReader(body, total, fn), nil
+		}
+	}
+}
+
+// trackDownload wraps the body of resp to report its download progress.
+func (r *Request) trackDownload(resp *http.Response) {
+	fn := r.progress.download
+	if fn == nil {
+		return
+	}
+	resp.Body = r.newProgressReader(resp.Body, resp.ContentLength, fn)
+}
+
+func (r *Request) newProgressReader(body io.ReadCloser, total int64, fn ProgressFunc) *progressReader {
+	return &progressReader{
+		ReadCloser: body,
+		tracker:    r.newProgressTracker(total, fn),
+		finish:     true,
+	}
+}
+
+// progressReader counts the bytes read through it into a tracker. Several
+// readers can share one tracker, e.g. the segments of a download; only
+// those with finish set end the transfer when they reach EOF.
+type progressReader struct {
+	io.ReadCloser
+	tracker *progressTracker
+	finish  bool
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.ReadCloser.Read(b)
+	p.tracker.add(int64(n), err == io.EOF && p.finish)
+	return n, err
+}
+
+// progressTracker reports transferred bytes at most once per interval,
+// plus once when the transfer ends.
+type progressTracker struct {
+	mu          sync.Mutex
+	fn          ProgressFunc
+	clock       Clock
+	interval    time.Duration
+	total       int64
+	transferred int64
+	start       time.Time
+	last        time.Time
+	done        bool
+}
+
+func (r *Request) newProgressTracker(total int64, fn ProgressFunc) *progressTracker {
+	now := r.client.clock.Now()
+	return &progressTracker{
+		fn:       fn,
+		clock:    r.client.clock,
+		interval: r.progress.interval,
+		total:    total,
+		start:    now,
+		last:     now,
+	}
+}
+
+func (p *progressTracker) add(n int64, eof bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.transferred += n
+	if p.done {
+		return
+	}
+	now := p.clock.Now()
+	if eof || p.transferred == p.total {
+		p.done = true
+		p.report(now)
+	} else if n > 0 && now.Sub(p.last) >= p.interval {
+		p.report(now)
+	}
+}
+
+func (p *progressTracker) report(now time.Time) {
+	p.last = now
+	elapsed := now.Sub(p.start)
+	var rate float64
+	if elapsed > 0 {
+		rate = float64(p.transferred) / elapsed.Seconds()
+	}
+	p.fn(Progress{
+		Transferred: p.transferred,
+		Total:       p.total,
+		Rate:        rate,
+		Elapsed:     elapsed,
+		Done:        p.done,
+	})
+}
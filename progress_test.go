@@ -0,0 +1,138 @@
+package vortex
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type progressRecorder struct {
+	mu      sync.Mutex
+	reports []Progress
+}
+
+func (p *progressRecorder) record(progress Progress) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reports = append(p.reports, progress)
+}
+
+func (p *progressRecorder) Reports() []Progress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Progress(nil), p.reports...)
+}
+
+func TestUploadProgress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+	defer server.Close()
+
+	var progress progressRecorder
+	resp, err := New(Opt{BaseURL: server.URL}).R().
+		SetProgressInterval(0).
+		OnUploadProgress(progress.record).
+		SetFormFilePath("file", writeTempFile(t, strings.Repeat("x", 200000))).
+		Post("/upload", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	reports := progress.Reports()
+	if len(reports) < 2 {
+		t.Fatalf("expected several progress reports, got %+v", reports)
+	}
+	last := reports[len(reports)-1]
+	if !last.Done || last.Total <= 200000 || last.Transferred != last.Total {
+		t.Errorf("expected a final report covering the whole body, got %+v", last)
+	}
+	for i := 1; i < len(reports); i++ {
+		if reports[i].Transferred < reports[i-1].Transferred {
+			t.Errorf("expected progress to increase, got %d after %d", reports[i].Transferred, reports[i-1].Transferred)
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status code 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestDownloadProgress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "200000")
+		w.Write([]byte(strings.Repeat("x", 200000)))
+	}))
+	defer server.Close()
+
+	var progress progressRecorder
+	resp, err := New(Opt{BaseURL: server.URL}).
+		SetProgressInterval(0).
+		OnDownloadProgress(progress.record).
+		Get("/download")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(resp.Body) != 200000 {
+		t.Fatalf("expected the whole body, got %d bytes", len(resp.Body))
+	}
+
+	reports := progress.Reports()
+	last := reports[len(reports)-1]
+	if !last.Done || last.Total != 200000 || last.Transferred != 200000 || last.Percent() != 100 {
+		t.Errorf("expected a final report of 200000/200000 bytes, got %+v", last)
+	}
+	for _, report := range reports[:len(reports)-1] {
+		if report.Done {
+			t.Errorf("expected only the last report to be done, got %+v", report)
+		}
+	}
+}
+
+func TestDownloadProgressUnknownTotal(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("chunk"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("chunk"))
+	}))
+	defer server.Close()
+
+	var progress progressRecorder
+	_, err := New(Opt{BaseURL: server.URL}).R().
+		OnDownloadProgress(progress.record).
+		Get("/download")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	reports := progress.Reports()
+	last := reports[len(reports)-1]
+	if !last.Done || last.Total != -1 || last.Transferred != 10 || last.Percent() != -1 {
+		t.Errorf("expected a final report of 10 bytes of an unknown total, got %+v", last)
+	}
+}
+
+func TestProgressThrottled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 200000)))
+	}))
+	defer server.Close()
+
+	var progress progressRecorder
+	_, err := New(Opt{BaseURL: server.URL}).
+		SetClock(newFakeClock()).
+		SetProgressInterval(time.Second).
+		OnDownloadProgress(progress.record).
+		Get("/download")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	reports := progress.Reports()
+	if len(reports) != 1 || !reports[0].Done {
+		t.Errorf("expected only the final report while the clock stands still, got %+v", reports)
+	}
+}
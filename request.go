@@ -0,0 +1,562 @@
+package vortex
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// R returns a new request builder. It starts from the client defaults and
+// keeps its own headers, query, form, output and stream handler, so it can
+// be configured without affecting the client or other requests.
+func (c *Client) R() *Request {
+	retry := c.retry
+	retry.count = c.retries
+	return &Request{
+		Headers:       c.headers.Clone(),
+		QueryParams:   cloneValues(c.queryParams),
+		FormFilePath:  cloneStringMap(c.formFilePath),
+		FormData:      cloneStringMap(c.formData),
+		FormFile:      cloneFileMap(c.formFile),
+		insecure:      c.insecure,
+		client:        c,
+		retry:         retry,
+		errorOnStatus: c.errorOnStatus,
+		chunked:       c.chunked,
+		progress:      c.progress,
+		segments:      c.segments,
+		streaming:     c.streaming,
+		maxBodySize:   c.maxBodySize,
+		readTimeout:   c.readTimeout,
+		timeout:       c.httpClient.Timeout,
+		digest:        c.digest,
+		showSecrets:   c.showSecrets,
+		tokenSource:   c.tokenSource,
+		sigV4:         c.sigV4,
+		contentDigest: c.contentDigest,
+		verifyDigest:  c.verifyDigest,
+		messageSigner: c.messageSigner,
+		verifier:      c.verifier,
+		output:        c.output,
+		errorOutput:   c.errorOutput,
+		resultFor:     cloneResultFor(c.resultFor),
+		streamHandler: c.streamHandler,
+	}
+}
+
+func (r *Request) SetHeader(key, value string) *Request {
+	r.header().Set(key, value)
+	return r
+}
+
+func (r *Request) SetHeaders(headers map[string]string) *Request {
+	for key, value := range headers {
+		r.header().Set(key, value)
+	}
+	return r
+}
+
+func (r *Request) SetQueryParam(key, value string) *Request {
+	r.query().Set(key, value)
+	return r
+}
+
+func (r *Request) SetQueryParams(params map[string]interface{}) *Request {
+	for key, value := range params {
+		r.query().Set(key, fmt.Sprintf("%v", value))
+	}
+	return r
+}
+
+func (r *Request) SetQueryParamFromInterface(params interface{}) *Request {
+	setQueryParamFromInterface(r.query(), params)
+	return r
+}
+
+func (r *Request) SetContentType(contentType string) *Request {
+	r.header().Set("Content-Type", contentType)
+	return r
+}
+
+func (r *Request) SetOutput(output interface{}) *Request {
+	r.output = output
+	return r
+}
+
+// SetError sets the target non-2xx response bodies are decoded into. 2xx
+// bodies go to the output set with SetOutput.
+func (r *Request) SetError(errorOutput interface{}) *Request {
+	r.errorOutput = errorOutput
+	return r
+}
+
+// SetResultFor decodes responses with the given status code into target,
+// taking precedence over SetOutput and SetError.
+func (r *Request) SetResultFor(statusCode int, target interface{}) *Request {
+	if r.resultFor == nil {
+		r.resultFor = make(map[int]interface{})
+	}
+	r.resultFor[statusCode] = target
+	return r
+}
+
+func (r *Request) SetFormFilePath(key, filePath string) *Request {
+	if r.FormFilePath == nil {
+		r.FormFilePath = make(map[string]string)
+	}
+	r.FormFilePath[key] = filePath
+	return r
+}
+
+func (r *Request) SetFormFile(fieldName string, file multipart.File) *Request {
+	if r.FormFile == nil {
+		r.FormFile = make(map[string]multipart.File)
+	}
+	r.FormFile[fieldName] = file
+	return r
+}
+
+func (r *Request) SetFormData(params map[string]string) *Request {
+	if r.FormData == nil {
+		r.FormData = make(map[string]string)
+	}
+	for key, value := range params {
+		r.FormData[key] = value
+	}
+	return r
+}
+
+// SetContext sets the context used for the whole request lifecycle:
+// middleware, hooks, the stream handler and response decoding all observe
+// its cancellation and deadline.
+func (r *Request) SetContext(ctx context.Context) *Request {
+	r.ctx = ctx
+	return r
+}
+
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+func (r *Request) Stream(streamHandler func(*http.Response) error) *Request {
+	r.streamHandler = streamHandler
+	return r
+}
+
+func (r *Request) Get(endpoint string) (*Response, error) {
+	return r.execute("GET", endpoint, nil)
+}
+
+func (r *Request) Delete(endpoint string) (*Response, error) {
+	return r.execute("DELETE", endpoint, nil)
+}
+
+func (r *Request) Post(endpoint string, body interface{}) (*Response, error) {
+	return r.execute("POST", endpoint, body)
+}
+
+func (r *Request) Put(endpoint string, body interface{}) (*Response, error) {
+	return r.execute("PUT", endpoint, body)
+}
+
+func (r *Request) Patch(endpoint string, body interface{}) (*Response, error) {
+	return r.execute("PATCH", endpoint, body)
+}
+
+func (r *Request) header() http.Header {
+	if r.Headers == nil {
+		r.Headers = http.Header{}
+	}
+	return r.Headers
+}
+
+func (r *Request) query() url.Values {
+	if r.QueryParams == nil {
+		r.QueryParams = url.Values{}
+	}
+	return r.QueryParams
+}
+
+func (r *Request) hasFormData() bool {
+	return len(r.FormFilePath) > 0 || len(r.FormData) > 0 || len(r.FormFile) > 0 || len(r.parts) > 0
+}
+
+func (r *Request) execute(method, endpoint string, body interface{}) (*Response, error) {
+	c := r.client
+
+	if r.segments > 1 && r.outputFile != "" && method == http.MethodGet {
+		return r.downloadSegmented(endpoint)
+	}
+
+	reqBody, err := r.prepareRequestBody(body)
+	if err != nil {
+		return nil, err
+	}
+	if reqBody.close != nil {
+		defer reqBody.close()
+	}
+
+	ctx := r.Context()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	reqCtx, cancel, watchBody := r.withReadTimeout(ctx)
+	watched := false
+	defer func() {
+		if !watched {
+			cancel()
+		}
+	}()
+	req, err := http.NewRequestWithContext(reqCtx, method, c.baseURL+endpoint, reqBody.reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if reqBody.multipart {
+		req.ContentLength = reqBody.length
+		req.GetBody = reqBody.getBody
+	}
+
+	r.setRequestHeaders(req, reqBody)
+	if r.contentDigest != "" {
+		if err := r.setContentDigest(req, reqBody); err != nil {
+			return nil, err
+		}
+	}
+	if r.sigV4 != nil && r.progress.upload != nil {
+		if req, err = r.sigV4.withPayloadHash(req, reqBody); err != nil {
+			return nil, err
+		}
+	}
+	r.trackUpload(req)
+
+	var offset int64
+	if r.outputFile != "" {
+		offset = r.prepareDownload(req)
+	}
+
+	request := *r
+	request.Method = method
+	request.URL = c.baseURL + endpoint
+	request.Headers = req.Header
+	request.Body = reqBody.data
+	request.bodyStream = reqBody.stream
+
+	var exec execution
+	start := time.Now()
+	resp, err := r.do(r.httpClient(), req, &exec)
+	if err != nil {
+		return nil, newTransportError(req, contextError(ctx, r.timeoutError(err)))
+	}
+	watchBody(resp)
+	watched = true
+	r.trackDownload(resp)
+	streamed := r.streaming && r.streamHandler == nil && r.outputFile == "" && resp.StatusCode >= 200 && resp.StatusCode <= 299
+	if !streamed {
+		defer resp.Body.Close()
+	}
+
+	if r.outputFile != "" && offset > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		removeDownload(r.outputFile)
+		return r.execute(method, endpoint, body)
+	}
+
+	newResult := func(body []byte) *Response {
+		response := newResponse(resp, body)
+		response.Output = r.output
+		response.ErrorOutput = r.errorOutput
+		response.Request = &request
+		response.Attempts = exec.attempts
+		response.Duration = time.Since(start)
+		return response
+	}
+
+	// Bodies that are streamed, handed to a stream handler or downloaded are
+	// not held in memory, so only their headers are verified, before the
+	// body reaches the caller or the file.
+	downloaded := r.isDownload(resp, offset)
+	buffered := !streamed && !downloaded && r.streamHandler == nil
+	if !buffered {
+		if err := r.verifyResponse(resp, nil); err != nil {
+			if streamed {
+				resp.Body.Close()
+			}
+			return newResult(nil), err
+		}
+	}
+
+	if r.streamHandler != nil {
+		err := r.streamHandler(resp)
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+	}
+
+	var respBody []byte
+	var checksumErr *ChecksumError
+	if downloaded {
+		err = r.writeDownload(req, resp, offset)
+		if err != nil && !errors.As(err, &checksumErr) {
+			return nil, err
+		}
+	} else if buffered {
+		respBody, err = r.readBody(resp)
+		if err != nil {
+			var tooLarge *ResponseTooLargeError
+			if errors.As(err, &tooLarge) {
+				return nil, err
+			}
+			return nil, newTransportError(req, contextError(ctx, r.timeoutError(err)))
+		}
+	}
+
+	response := newResult(respBody)
+	if checksumErr != nil {
+		return response, checksumErr
+	}
+	if buffered {
+		if err := r.verifyResponse(resp, respBody); err != nil {
+			return response, err
+		}
+	}
+	if downloaded {
+		response.File = r.outputFile
+	}
+	if streamed {
+		response.RawBody = &streamBody{ReadCloser: resp.Body, req: req, request: r, ctx: ctx}
+	}
+
+	if target := r.resultTarget(response); target != nil && len(respBody) > 0 {
+		response.Result = target
+		err = r.responseCodec(response.Header("Content-Type"), target).Decode(respBody, target)
+		if err != nil {
+			return response, &DecodeError{
+				StatusCode:  resp.StatusCode,
+				ContentType: resp.Header.Get("Content-Type"),
+				Body:        respBody,
+				Err:         err,
+			}
+		}
+	}
+
+	if r.errorOnStatus && !response.IsSuccess() {
+		return response, &HTTPError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Body:       respBody,
+		}
+	}
+
+	return response, nil
+}
+
+// resultTarget picks the target the response body is decoded into: the one
+// registered for its status code, otherwise the output for 2xx responses
+// and the error target for everything else.
+func (r *Request) resultTarget(response *Response) interface{} {
+	if target, ok := r.resultFor[response.StatusCode]; ok {
+		return target
+	}
+	if response.IsSuccess() {
+		return r.output
+	}
+	return r.errorOutput
+}
+
+// httpClient returns the client used to send the request: the configured
+// http.Client with its transport wrapped in the middleware chain.
+func (r *Request) httpClient() *http.Client {
+	c := r.client
+	httpClient := *c.httpClient
+	httpClient.Timeout = r.timeout
+	transport := httpClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if r.messageSigner != nil {
+		transport = &messageSignerTransport{next: transport, signer: r.messageSigner}
+	}
+	if r.sigV4 != nil {
+		transport = &sigV4Transport{next: transport, signer: r.sigV4}
+	}
+	if r.digest != nil {
+		transport = &digestTransport{next: transport, auth: r.digest}
+	}
+	if r.tokenSource != nil {
+		transport = &tokenTransport{next: transport, source: r.tokenSource}
+	}
+	httpClient.Transport = chainRoundTrippers(transport, c.middleware)
+	return &httpClient
+}
+
+// requestBody is an encoded request body together with what is needed to
+// send and record it.
+type requestBody struct {
+	reader      io.Reader
+	data        []byte
+	contentType string
+	length      int64
+	getBody     func() (io.ReadCloser, error)
+	close       func()
+	multipart   bool
+	stream      bool
+}
+
+// prepareRequestBody encodes body according to its type: form data becomes
+// multipart, []byte and string are sent as they are, url.Values is form
+// encoded and an io.Reader is streamed. Anything else goes through the
+// codec registered for the request Content-Type, JSON by default.
+func (r *Request) prepareRequestBody(body interface{}) (*requestBody, error) {
+	if r.hasFormData() {
+		parts, err := r.formParts()
+		if err != nil {
+			return nil, err
+		}
+		multipartBody := newMultipartBody(parts)
+		length := multipartBody.length()
+		if r.chunked {
+			length = -1
+		}
+		body := &requestBody{
+			reader:      multipartBody.reader(),
+			contentType: multipartBody.contentType(),
+			length:      length,
+			close:       r.closeFormFiles,
+			multipart:   true,
+		}
+		if multipartBody.reusable() {
+			body.getBody = func() (io.ReadCloser, error) {
+				return multipartBody.reader(), nil
+			}
+		}
+		return body, nil
+	}
+
+	switch body := body.(type) {
+	case nil:
+		return &requestBody{}, nil
+	case []byte:
+		return newRequestBody(body, "application/octet-stream"), nil
+	case string:
+		return newRequestBody([]byte(body), "text/plain; charset=utf-8"), nil
+	case url.Values:
+		return newRequestBody([]byte(body.Encode()), "application/x-www-form-urlencoded"), nil
+	case io.Reader:
+		return &requestBody{
+			reader:      body,
+			contentType: "application/octet-stream",
+			stream:      true,
+		}, nil
+	}
+
+	contentType := r.Headers.Get("Content-Type")
+	codec, ok := r.client.codecFor(contentType)
+	if !ok {
+		codec, contentType = JSONCodec{}, "application/json"
+	}
+	data, err := codec.Encode(body)
+	if err != nil {
+		return nil, err
+	}
+	return newRequestBody(data, contentType), nil
+}
+
+func newRequestBody(data []byte, contentType string) *requestBody {
+	return &requestBody{
+		reader:      bytes.NewReader(data),
+		data:        data,
+		contentType: contentType,
+	}
+}
+
+func (r *Request) setRequestHeaders(req *http.Request, body *requestBody) {
+	if len(r.QueryParams) > 0 {
+		query := req.URL.Query()
+		for key, values := range r.QueryParams {
+			query[key] = values
+		}
+		req.URL.RawQuery = query.Encode()
+	}
+
+	for key, values := range r.Headers {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	if body.contentType != "" && (body.multipart || req.Header.Get("Content-Type") == "") {
+		req.Header.Set("Content-Type", body.contentType)
+	}
+}
+
+func (r *Request) closeFormFiles() {
+	for _, file := range r.FormFile {
+		file.Close()
+	}
+}
+
+// execution collects what happened while a request was being sent.
+type execution struct {
+	attempts int
+}
+
+// contextError makes sure an error caused by a cancelled or expired context
+// matches context.Canceled or context.DeadlineExceeded with errors.Is.
+func contextError(ctx context.Context, err error) error {
+	ctxErr := ctx.Err()
+	if ctxErr == nil || errors.Is(err, ctxErr) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ctxErr, err)
+}
+
+func cloneValues(values url.Values) url.Values {
+	clone := make(url.Values, len(values))
+	for key, value := range values {
+		clone[key] = append([]string(nil), value...)
+	}
+	return clone
+}
+
+func cloneStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	clone := make(map[string]string, len(m))
+	for key, value := range m {
+		clone[key] = value
+	}
+	return clone
+}
+
+func cloneResultFor(m map[int]interface{}) map[int]interface{} {
+	if m == nil {
+		return nil
+	}
+	clone := make(map[int]interface{}, len(m))
+	for key, value := range m {
+		clone[key] = value
+	}
+	return clone
+}
+
+func cloneFileMap(m map[string]multipart.File) map[string]multipart.File {
+	if m == nil {
+		return nil
+	}
+	clone := make(map[string]multipart.File, len(m))
+	for key, value := range m {
+		clone[key] = value
+	}
+	return clone
+}
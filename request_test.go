@@ -0,0 +1,355 @@
+package vortex
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRequestInheritsClientDefaults(t *testing.T) {
+	client := New(Opt{BaseURL: "http://example.com"})
+	client.SetHeader("Accept", "application/json").
+		SetQueryParam("key", "value").
+		SetFormData(map[string]string{"field": "value"})
+
+	req := client.R()
+
+	if req.Headers.Get("Accept") != "application/json" {
+		t.Errorf("expected Accept header to be application/json, got %s", req.Headers.Get("Accept"))
+	}
+	if req.QueryParams.Get("key") != "value" {
+		t.Errorf("expected query param key to be value, got %s", req.QueryParams.Get("key"))
+	}
+	if req.FormData["field"] != "value" {
+		t.Errorf("expected form data field to be value, got %s", req.FormData["field"])
+	}
+}
+
+func TestRequestDoesNotLeakIntoClient(t *testing.T) {
+	client := New(Opt{BaseURL: "http://example.com"})
+	client.SetHeader("Accept", "application/json")
+
+	var output map[string]string
+	client.R().
+		SetHeader("Authorization", "Bearer token").
+		SetHeader("Accept", "text/plain").
+		SetQueryParam("key", "value").
+		SetFormData(map[string]string{"field": "value"}).
+		SetOutput(&output)
+
+	if client.headers.Get("Authorization") != "" {
+		t.Errorf("expected no Authorization header on client, got %s", client.headers.Get("Authorization"))
+	}
+	if client.headers.Get("Accept") != "application/json" {
+		t.Errorf("expected Accept header to be application/json, got %s", client.headers.Get("Accept"))
+	}
+	if len(client.queryParams) != 0 {
+		t.Errorf("expected no query params on client, got %v", client.queryParams)
+	}
+	if len(client.formData) != 0 {
+		t.Errorf("expected no form data on client, got %v", client.formData)
+	}
+	if client.output != nil {
+		t.Errorf("expected no output on client, got %v", client.output)
+	}
+}
+
+func TestRequestGet(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "` + r.URL.Query().Get("id") + `", "token": "` + r.Header.Get("X-Token") + `"}`))
+	}))
+	defer server.Close()
+
+	client := New(Opt{BaseURL: server.URL})
+	client.SetHeader("X-Token", "default")
+
+	var first, second struct {
+		ID    string `json:"id"`
+		Token string `json:"token"`
+	}
+	_, err := client.R().
+		SetHeader("X-Token", "first").
+		SetQueryParam("id", "1").
+		SetOutput(&first).
+		Get("/test")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	_, err = client.R().
+		SetOutput(&second).
+		Get("/test")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if first.ID != "1" || first.Token != "first" {
+		t.Errorf("expected first response to be {1 first}, got %+v", first)
+	}
+	if second.ID != "" || second.Token != "default" {
+		t.Errorf("expected second response to be { default}, got %+v", second)
+	}
+}
+
+func TestRequestConcurrentUse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": "` + r.Header.Get("X-Id") + `"}`))
+	}))
+	defer server.Close()
+
+	client := New(Opt{BaseURL: server.URL})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			var output struct {
+				ID string `json:"id"`
+			}
+			_, err := client.R().
+				SetHeader("X-Id", id).
+				SetOutput(&output).
+				Post("/test", map[string]string{"id": id})
+			if err != nil {
+				t.Errorf("expected no error, got %v", err)
+				return
+			}
+			if output.ID != id {
+				t.Errorf("expected id %s, got %s", id, output.ID)
+			}
+		}(string(rune('a' + i)))
+	}
+	wg.Wait()
+}
+
+func TestRequestRecordsCurlCommand(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := New(Opt{BaseURL: server.URL})
+	resp, err := client.R().
+		SetQueryParam("page", "2").
+		Get("/items")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := `curl -X GET "` + server.URL + `/items?page=2"`
+	if curl := resp.Request.GenerateCurlCommand(); curl != expected {
+		t.Errorf("expected curl command %s, got %s", expected, curl)
+	}
+}
+
+type contextKey string
+
+func TestRequestContextCanceled(t *testing.T) {
+	client := New(Opt{BaseURL: "http://example.com"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := client.R().SetContext(ctx).Get("/test")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestRequestContextDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	client := New(Opt{BaseURL: server.URL})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	resp, err := client.R().SetContext(ctx).Get("/slow")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if resp != nil {
+		t.Errorf("expected no response, got %+v", resp)
+	}
+}
+
+func TestRequestContextPropagation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	key := contextKey("trace")
+	var middlewareValue, hookValue, streamValue interface{}
+
+	client := New(Opt{BaseURL: server.URL})
+	client.UseMiddleware(func(req *http.Request, next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			middlewareValue = r.Context().Value(key)
+			next(w, r)
+		}
+	})
+	client.UseHook(func(req *http.Request, resp *http.Response) {
+		hookValue = req.Context().Value(key)
+	})
+
+	ctx := context.WithValue(context.Background(), key, "abc")
+	_, err := client.R().
+		SetContext(ctx).
+		Stream(func(resp *http.Response) error {
+			streamValue = resp.Request.Context().Value(key)
+			return nil
+		}).
+		Get("/test")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for name, value := range map[string]interface{}{"middleware": middlewareValue, "hook": hookValue, "stream": streamValue} {
+		if value != "abc" {
+			t.Errorf("expected %s to see context value abc, got %v", name, value)
+		}
+	}
+}
+
+func TestRequestContextCanceledDuringStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher := w.(http.Flusher)
+		for i := 0; ; i++ {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			fmt.Fprintf(w, "data: %d\n\n", i)
+			flusher.Flush()
+		}
+	}))
+	defer server.Close()
+
+	client := New(Opt{BaseURL: server.URL})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := client.R().
+		SetContext(ctx).
+		Stream(func(resp *http.Response) error {
+			scanner := bufio.NewScanner(resp.Body)
+			lines := 0
+			for scanner.Scan() {
+				lines++
+				if lines == 3 {
+					cancel()
+				}
+			}
+			return scanner.Err()
+		}).
+		Get("/events")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func newEchoServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Content-Type", r.Header.Get("Content-Type"))
+		w.Write(body)
+	}))
+}
+
+func TestRequestBodyEncoders(t *testing.T) {
+	server := newEchoServer()
+	defer server.Close()
+
+	type user struct {
+		XMLName xml.Name `xml:"user" json:"-"`
+		Name    string   `xml:"name" json:"name"`
+	}
+
+	tests := []struct {
+		name        string
+		request     func(*Request) *Request
+		body        interface{}
+		contentType string
+		expected    string
+	}{
+		{"json", nil, map[string]string{"name": "vortex"}, "application/json", `{"name":"vortex"}`},
+		{"form values", nil, url.Values{"name": {"vortex"}}, "application/x-www-form-urlencoded", `name=vortex`},
+		{"form struct", func(r *Request) *Request { return r.SetContentType("application/x-www-form-urlencoded") }, user{Name: "vortex"}, "application/x-www-form-urlencoded", `name=vortex`},
+		{"xml", func(r *Request) *Request { return r.SetContentType("application/xml") }, user{Name: "vortex"}, "application/xml", `<user><name>vortex</name></user>`},
+		{"bytes", nil, []byte{0x01, 0x02}, "application/octet-stream", "\x01\x02"},
+		{"string", nil, "hello", "text/plain; charset=utf-8", `hello`},
+		{"reader", nil, strings.NewReader("streamed"), "application/octet-stream", `streamed`},
+		{"ndjson", func(r *Request) *Request { return r.SetContentType("application/x-ndjson") }, []user{{Name: "a"}, {Name: "b"}}, "application/x-ndjson", "{\"name\":\"a\"}\n{\"name\":\"b\"}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := New(Opt{BaseURL: server.URL}).R()
+			if tt.request != nil {
+				req = tt.request(req)
+			}
+			resp, err := req.Post("/test", tt.body)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if contentType := resp.Header("X-Content-Type"); contentType != tt.contentType {
+				t.Errorf("expected Content-Type %s, got %s", tt.contentType, contentType)
+			}
+			if string(resp.Body) != tt.expected {
+				t.Errorf("expected body %q, got %q", tt.expected, string(resp.Body))
+			}
+		})
+	}
+}
+
+func TestRequestBodyCurlCommand(t *testing.T) {
+	server := newEchoServer()
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		request  func(*Request) *Request
+		body     interface{}
+		expected string
+	}{
+		{"raw", nil, "it's", ` --data-raw 'it'\''s'`},
+		{"form", nil, url.Values{"a": {"1"}}, ` --data-raw 'a=1'`},
+		{"binary", nil, []byte{0xff}, ` --data-binary @-`},
+		{"reader", nil, strings.NewReader("streamed"), ` --data-binary @-`},
+		{"ndjson", func(r *Request) *Request { return r.SetContentType("application/x-ndjson") }, []int{1, 2}, " --data-binary '1\n2\n'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := New(Opt{BaseURL: server.URL}).R()
+			if tt.request != nil {
+				req = tt.request(req)
+			}
+			resp, err := req.Post("/test", tt.body)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if curl := resp.Request.GenerateCurlCommand(); !strings.HasSuffix(curl, tt.expected) {
+				t.Errorf("expected curl command to end with %q, got %q", tt.expected, curl)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package vortex
+
+import (
+	"net/http"
+)
+
+func newResponse(resp *http.Response, body []byte) *Response {
+	response := &Response{
+		StatusCode:    resp.StatusCode,
+		Status:        resp.Status,
+		Body:          body,
+		Headers:       resp.Header,
+		Cookies:       resp.Cookies(),
+		Trailer:       resp.Trailer,
+		Proto:         resp.Proto,
+		ContentLength: resp.ContentLength,
+		TLS:           resp.TLS,
+	}
+	if resp.Request != nil && resp.Request.URL != nil {
+		response.FinalURL = resp.Request.URL.String()
+	}
+	return response
+}
+
+// IsSuccess reports whether the status code is 2xx.
+func (r *Response) IsSuccess() bool {
+	return r.StatusCode >= 200 && r.StatusCode <= 299
+}
+
+// IsError reports whether the status code is 4xx or 5xx.
+func (r *Response) IsError() bool {
+	return r.StatusCode >= 400
+}
+
+// Header returns the first value of the response header key.
+func (r *Response) Header(key string) string {
+	return r.Headers.Get(key)
+}
+
+func (r *Response) String() string {
+	return string(r.Body)
+}
@@ -0,0 +1,198 @@
+package vortex
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseMetadata(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusFound)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Trailer", "X-Checksum")
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"message": "success"}`))
+		w.Header().Set("X-Checksum", "1234")
+	})
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+
+	client := New(Opt{BaseURL: server.URL})
+	client.httpClient.Transport = server.Client().Transport
+
+	resp, err := client.Get("/old")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if resp.Header("Content-Type") != "application/json" {
+		t.Errorf("expected Content-Type header to be application/json, got %s", resp.Header("Content-Type"))
+	}
+	if len(resp.Cookies) != 1 || resp.Cookies[0].Name != "session" || resp.Cookies[0].Value != "abc" {
+		t.Errorf("expected session cookie, got %v", resp.Cookies)
+	}
+	if resp.Trailer.Get("X-Checksum") != "1234" {
+		t.Errorf("expected X-Checksum trailer to be 1234, got %s", resp.Trailer.Get("X-Checksum"))
+	}
+	if resp.FinalURL != server.URL+"/new" {
+		t.Errorf("expected final URL %s/new, got %s", server.URL, resp.FinalURL)
+	}
+	if resp.TLS == nil {
+		t.Errorf("expected TLS connection state")
+	}
+	if resp.Proto != "HTTP/1.1" {
+		t.Errorf("expected protocol HTTP/1.1, got %s", resp.Proto)
+	}
+	if resp.Status != "200 OK" {
+		t.Errorf("expected status 200 OK, got %s", resp.Status)
+	}
+	if resp.Attempts != 1 {
+		t.Errorf("expected 1 attempt, got %d", resp.Attempts)
+	}
+	if resp.Duration <= 0 {
+		t.Errorf("expected a positive duration, got %v", resp.Duration)
+	}
+	if resp.String() != `{"message": "success"}` {
+		t.Errorf("expected body as string, got %s", resp.String())
+	}
+}
+
+func TestResponseContentLength(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "5")
+		w.Write([]byte(`hello`))
+	}))
+	defer server.Close()
+
+	resp, err := New(Opt{BaseURL: server.URL}).Get("/test")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.ContentLength != 5 {
+		t.Errorf("expected content length 5, got %d", resp.ContentLength)
+	}
+}
+
+func TestResponseStatusHelpers(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		success    bool
+		isError    bool
+	}{
+		{http.StatusOK, true, false},
+		{http.StatusNoContent, true, false},
+		{http.StatusNotModified, false, false},
+		{http.StatusNotFound, false, true},
+		{http.StatusBadGateway, false, true},
+	}
+
+	for _, tt := range tests {
+		resp := &Response{StatusCode: tt.statusCode}
+		if resp.IsSuccess() != tt.success {
+			t.Errorf("expected IsSuccess for %d to be %v", tt.statusCode, tt.success)
+		}
+		if resp.IsError() != tt.isError {
+			t.Errorf("expected IsError for %d to be %v", tt.statusCode, tt.isError)
+		}
+	}
+}
+
+func TestSetError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"error": "invalid email"}`))
+			return
+		}
+		w.Write([]byte(`{"message": "success"}`))
+	}))
+	defer server.Close()
+
+	type result struct {
+		Message string `json:"message"`
+	}
+	type apiError struct {
+		Error string `json:"error"`
+	}
+
+	client := New(Opt{BaseURL: server.URL})
+
+	var ok result
+	var okErr apiError
+	resp, err := client.R().SetOutput(&ok).SetError(&okErr).Get("/ok")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if ok.Message != "success" || okErr.Error != "" {
+		t.Errorf("expected only the output to be filled, got %+v and %+v", ok, okErr)
+	}
+	if resp.Result != &ok {
+		t.Errorf("expected the output to be the result")
+	}
+
+	var fail result
+	var failErr apiError
+	resp, err = client.R().SetOutput(&fail).SetError(&failErr).Post("/fail", nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if fail.Message != "" || failErr.Error != "invalid email" {
+		t.Errorf("expected only the error to be filled, got %+v and %+v", fail, failErr)
+	}
+	if resp.Result != &failErr || resp.ErrorOutput != &failErr {
+		t.Errorf("expected the error target to be the result")
+	}
+}
+
+func TestSetErrorSkipsUndecodableErrorPage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`<html>Internal Server Error</html>`))
+	}))
+	defer server.Close()
+
+	var output map[string]interface{}
+	resp, err := New(Opt{BaseURL: server.URL}).R().SetOutput(&output).Get("/test")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.Result != nil {
+		t.Errorf("expected nothing to be decoded, got %v", resp.Result)
+	}
+}
+
+func TestSetResultFor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"job": "42"}`))
+	}))
+	defer server.Close()
+
+	var output map[string]string
+	var accepted struct {
+		Job string `json:"job"`
+	}
+	client := New(Opt{BaseURL: server.URL}).SetResultFor(http.StatusAccepted, &accepted)
+
+	resp, err := client.R().SetOutput(&output).Post("/jobs", map[string]string{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if accepted.Job != "42" {
+		t.Errorf("expected job 42, got %s", accepted.Job)
+	}
+	if output != nil {
+		t.Errorf("expected output to be left untouched, got %v", output)
+	}
+	if resp.Result != &accepted {
+		t.Errorf("expected the 202 target to be the result")
+	}
+}
@@ -0,0 +1,376 @@
+package vortex
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRetryWaitMin = 100 * time.Millisecond
+	defaultRetryWaitMax = 2 * time.Second
+)
+
+var defaultRetryStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryPolicy decides whether a failed attempt is retried and how long to
+// wait before the next one. attempt is the number of attempts made so far.
+type RetryPolicy interface {
+	ShouldRetry(resp *http.Response, err error, attempt int) bool
+	Backoff(attempt int) time.Duration
+}
+
+// RetryHook is called before every retry with the attempt that failed, its
+// response or error, and the time vortex is about to wait.
+type RetryHook func(req *http.Request, resp *http.Response, err error, attempt int, wait time.Duration)
+
+type retryConfig struct {
+	count         int
+	waitMin       time.Duration
+	waitMax       time.Duration
+	statusCodes   []int
+	policy        RetryPolicy
+	budget        time.Duration
+	nonIdempotent bool
+	hooks         []RetryHook
+}
+
+func newRetryConfig() retryConfig {
+	return retryConfig{
+		waitMin:     defaultRetryWaitMin,
+		waitMax:     defaultRetryWaitMax,
+		statusCodes: defaultRetryStatusCodes,
+	}
+}
+
+func (rc retryConfig) retryPolicy() RetryPolicy {
+	if rc.policy != nil {
+		return rc.policy
+	}
+	return &ExponentialBackoff{
+		MaxRetries:  rc.count,
+		Min:         rc.waitMin,
+		Max:         rc.waitMax,
+		StatusCodes: rc.statusCodes,
+	}
+}
+
+func (c *Client) SetRetries(count int) *Client {
+	c.retries = count
+	return c
+}
+
+// SetRetryWaitTime sets the bounds of the exponential backoff between
+// attempts. A Retry-After header sent by the server takes precedence, but
+// is capped at max.
+func (c *Client) SetRetryWaitTime(min, max time.Duration) *Client {
+	c.retry.waitMin = min
+	c.retry.waitMax = max
+	return c
+}
+
+func (c *Client) SetRetryStatusCodes(codes ...int) *Client {
+	c.retry.statusCodes = codes
+	return c
+}
+
+// RetryNonIdempotent allows POST and PATCH requests to be retried as well.
+func (c *Client) RetryNonIdempotent() *Client {
+	c.retry.nonIdempotent = true
+	return c
+}
+
+// UseRetryPolicy replaces the default exponential backoff, including the
+// retry count, wait time and status codes configured on the client.
+func (c *Client) UseRetryPolicy(policy RetryPolicy) *Client {
+	c.retry.policy = policy
+	return c
+}
+
+// SetRetryBudget limits the total time spent on a request, retries
+// included. No retry is started if its backoff would exceed the budget.
+func (c *Client) SetRetryBudget(budget time.Duration) *Client {
+	c.retry.budget = budget
+	return c
+}
+
+func (c *Client) OnRetry(hooks ...RetryHook) *Client {
+	c.retry.hooks = append(c.retry.hooks, hooks...)
+	return c
+}
+
+func (r *Request) SetRetries(count int) *Request {
+	r.retry.count = count
+	return r
+}
+
+func (r *Request) SetRetryWaitTime(min, max time.Duration) *Request {
+	r.retry.waitMin = min
+	r.retry.waitMax = max
+	return r
+}
+
+func (r *Request) SetRetryStatusCodes(codes ...int) *Request {
+	r.retry.statusCodes = codes
+	return r
+}
+
+func (r *Request) RetryNonIdempotent() *Request {
+	r.retry.nonIdempotent = true
+	return r
+}
+
+func (r *Request) UseRetryPolicy(policy RetryPolicy) *Request {
+	r.retry.policy = policy
+	return r
+}
+
+func (r *Request) SetRetryBudget(budget time.Duration) *Request {
+	r.retry.budget = budget
+	return r
+}
+
+func (r *Request) OnRetry(hooks ...RetryHook) *Request {
+	r.retry.hooks = append(r.retry.hooks[:len(r.retry.hooks):len(r.retry.hooks)], hooks...)
+	return r
+}
+
+type attemptKey struct{}
+
+// RetryAttempt returns the attempt number of req, starting at 1. It can be
+// used from hooks and middleware to tell retries apart.
+func RetryAttempt(req *http.Request) int {
+	if attempt, ok := req.Context().Value(attemptKey{}).(int); ok {
+		return attempt
+	}
+	return 1
+}
+
+// do sends req, retrying it according to the request retry policy. Hooks
+// run for every attempt that produced a response.
+func (r *Request) do(httpClient *http.Client, req *http.Request, exec *execution) (*http.Response, error) {
+	c := r.client
+	ctx := req.Context()
+	policy := r.retry.retryPolicy()
+	start := c.clock.Now()
+
+	for attempt := 1; ; attempt++ {
+		attemptReq, err := newAttemptRequest(req, attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		exec.attempts = attempt
+		resp, err := httpClient.Do(attemptReq)
+		if err == nil {
+			for _, hook := range c.hooks {
+				hook(attemptReq, resp)
+			}
+		}
+
+		if !r.retry.canRetry(req) || !policy.ShouldRetry(resp, err, attempt) {
+			return resp, err
+		}
+
+		wait := policy.Backoff(attempt)
+		if after, ok := retryAfter(resp, c.clock.Now()); ok {
+			wait = after
+			if r.retry.waitMax > 0 && wait > r.retry.waitMax {
+				wait = r.retry.waitMax
+			}
+		}
+		if r.retry.budget > 0 && c.clock.Now().Add(wait).Sub(start) > r.retry.budget {
+			return resp, err
+		}
+
+		for _, hook := range r.retry.hooks {
+			hook(attemptReq, resp, err, attempt, wait)
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if err := sleep(ctx, c.clock, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func newAttemptRequest(req *http.Request, attempt int) (*http.Request, error) {
+	attemptReq := req.WithContext(context.WithValue(req.Context(), attemptKey{}, attempt))
+	attemptReq.Header = req.Header.Clone()
+	if attempt > 1 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		attemptReq.Body = body
+	}
+	return attemptReq, nil
+}
+
+// canRetry reports whether req may be sent again at all, whatever the
+// policy says: its context is still alive, its body can be replayed and its
+// method is idempotent unless configured otherwise.
+func (rc retryConfig) canRetry(req *http.Request) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	return rc.nonIdempotent || isIdempotent(req.Method)
+}
+
+// IsRetryable reports whether an attempt failed with a connection error or
+// with one of the given status codes. A nil codes slice uses 429, 502, 503
+// and 504. Cancelled and expired contexts are never retryable.
+func IsRetryable(resp *http.Response, err error, codes []int) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	if resp == nil {
+		return false
+	}
+	if codes == nil {
+		codes = defaultRetryStatusCodes
+	}
+	for _, code := range codes {
+		if resp.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// ConstantBackoff waits the same amount of time before every retry.
+type ConstantBackoff struct {
+	MaxRetries  int
+	Wait        time.Duration
+	StatusCodes []int
+}
+
+func (p *ConstantBackoff) ShouldRetry(resp *http.Response, err error, attempt int) bool {
+	return attempt <= p.MaxRetries && IsRetryable(resp, err, p.StatusCodes)
+}
+
+func (p *ConstantBackoff) Backoff(attempt int) time.Duration {
+	return p.Wait
+}
+
+// ExponentialBackoff doubles the wait after every attempt, from Min up to
+// Max, and picks a random wait between half and all of it.
+type ExponentialBackoff struct {
+	MaxRetries  int
+	Min         time.Duration
+	Max         time.Duration
+	StatusCodes []int
+}
+
+func (p *ExponentialBackoff) ShouldRetry(resp *http.Response, err error, attempt int) bool {
+	return attempt <= p.MaxRetries && IsRetryable(resp, err, p.StatusCodes)
+}
+
+func (p *ExponentialBackoff) Backoff(attempt int) time.Duration {
+	wait := p.Min
+	for i := 1; i < attempt && wait < p.Max; i++ {
+		wait *= 2
+	}
+	if wait > p.Max {
+		wait = p.Max
+	}
+	if wait <= 0 {
+		return 0
+	}
+
+	half := wait / 2
+	return half + randomDuration(wait-half)
+}
+
+// DecorrelatedJitter implements the "decorrelated jitter" backoff, where
+// every wait is random between Base and three times the previous wait,
+// capped at Max.
+type DecorrelatedJitter struct {
+	MaxRetries  int
+	Base        time.Duration
+	Max         time.Duration
+	StatusCodes []int
+}
+
+func (p *DecorrelatedJitter) ShouldRetry(resp *http.Response, err error, attempt int) bool {
+	return attempt <= p.MaxRetries && IsRetryable(resp, err, p.StatusCodes)
+}
+
+// Backoff replays the chain of waits up to attempt, so the policy keeps no
+// state and can be shared between concurrent requests.
+func (p *DecorrelatedJitter) Backoff(attempt int) time.Duration {
+	wait := p.Base
+	for i := 0; i < attempt; i++ {
+		wait = p.Base + randomDuration(wait*3-p.Base)
+		if wait > p.Max {
+			wait = p.Max
+		}
+	}
+	return wait
+}
+
+func randomDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max) + 1))
+}
+
+// retryAfter parses the Retry-After header, which is either a number of
+// seconds or an HTTP date.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := date.Sub(now)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+func sleep(ctx context.Context, clock Clock, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-clock.After(d):
+		return nil
+	}
+}
@@ -0,0 +1,364 @@
+package vortex
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryOnStatusCode(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"message": "success"}`))
+	}))
+	defer server.Close()
+
+	client := New(Opt{BaseURL: server.URL, Retries: 3}).
+		SetRetryWaitTime(time.Millisecond, 5*time.Millisecond)
+
+	var attempts []int
+	client.UseHook(func(req *http.Request, resp *http.Response) {
+		attempts = append(attempts, RetryAttempt(req))
+	})
+
+	resp, err := client.Get("/test")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status code 200, got %d", resp.StatusCode)
+	}
+	if resp.Attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", resp.Attempts)
+	}
+	if len(attempts) != 3 || attempts[0] != 1 || attempts[2] != 3 {
+		t.Errorf("expected hooks to see attempts [1 2 3], got %v", attempts)
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client := New(Opt{BaseURL: server.URL, Retries: 2}).
+		SetRetryWaitTime(time.Millisecond, time.Millisecond)
+
+	resp, err := client.Get("/test")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("expected status code 502, got %d", resp.StatusCode)
+	}
+	if calls != 3 || resp.Attempts != 3 {
+		t.Errorf("expected 3 calls and attempts, got %d calls and %d attempts", calls, resp.Attempts)
+	}
+}
+
+func TestRetrySkipsNonIdempotentMethods(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := New(Opt{BaseURL: server.URL, Retries: 3}).
+		SetRetryWaitTime(time.Millisecond, time.Millisecond)
+
+	resp, err := client.Post("/test", map[string]string{"key": "value"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if calls != 1 || resp.Attempts != 1 {
+		t.Errorf("expected a single attempt, got %d calls and %d attempts", calls, resp.Attempts)
+	}
+}
+
+func TestRetryReplaysBody(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	client := New(Opt{BaseURL: server.URL, Retries: 1}).
+		SetRetryWaitTime(time.Millisecond, time.Millisecond)
+
+	resp, err := client.R().
+		RetryNonIdempotent().
+		Post("/test", map[string]string{"key": "value"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("expected status code 201, got %d", resp.StatusCode)
+	}
+	if len(bodies) != 2 || bodies[0] != `{"key":"value"}` || bodies[1] != bodies[0] {
+		t.Errorf("expected the body to be replayed, got %q", bodies)
+	}
+}
+
+func TestRetryOnConnectionError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+
+	client := New(Opt{BaseURL: server.URL}).
+		SetRetries(2).
+		SetRetryWaitTime(time.Millisecond, time.Millisecond)
+
+	var exec execution
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	r := client.R()
+	_, err := r.do(r.httpClient(), req, &exec)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if exec.attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", exec.attempts)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"3"}}}
+	if wait, ok := retryAfter(resp, now); !ok || wait != 3*time.Second {
+		t.Errorf("expected 3s, got %v", wait)
+	}
+
+	date := now.Add(time.Minute).Format(http.TimeFormat)
+	resp = &http.Response{Header: http.Header{"Retry-After": []string{date}}}
+	if wait, ok := retryAfter(resp, now); !ok || wait != time.Minute {
+		t.Errorf("expected 1m, got %v", wait)
+	}
+
+	if _, ok := retryAfter(&http.Response{Header: http.Header{}}, now); ok {
+		t.Errorf("expected no Retry-After")
+	}
+}
+
+func TestRetryHonorsRetryAfter(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	clock := newFakeClock()
+	client := New(Opt{BaseURL: server.URL, Retries: 1}).SetClock(clock).SetRetryWaitTime(100*time.Millisecond, 10*time.Second)
+
+	resp, err := client.Get("/test")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status code 200, got %d", resp.StatusCode)
+	}
+	if waits := clock.Waits(); len(waits) != 1 || waits[0] != 7*time.Second {
+		t.Errorf("expected a single 7s wait, got %v", waits)
+	}
+}
+
+func TestRetryAfterIsCapped(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "86400")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	clock := newFakeClock()
+	client := New(Opt{BaseURL: server.URL, Retries: 1}).SetClock(clock)
+
+	if _, err := client.Get("/test"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if waits := clock.Waits(); len(waits) != 1 || waits[0] != defaultRetryWaitMax {
+		t.Errorf("expected the wait to be capped at %v, got %v", defaultRetryWaitMax, waits)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	policy := &ExponentialBackoff{Min: 100 * time.Millisecond, Max: time.Second}
+
+	for attempt, max := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second} {
+		for i := 0; i < 20; i++ {
+			wait := policy.Backoff(attempt)
+			if wait < max/2 || wait > max {
+				t.Errorf("expected backoff for attempt %d between %v and %v, got %v", attempt, max/2, max, wait)
+			}
+		}
+	}
+}
+
+func TestConstantBackoff(t *testing.T) {
+	policy := &ConstantBackoff{MaxRetries: 2, Wait: time.Second}
+
+	if wait := policy.Backoff(5); wait != time.Second {
+		t.Errorf("expected 1s, got %v", wait)
+	}
+	resp := &http.Response{StatusCode: http.StatusServiceUnavailable}
+	if !policy.ShouldRetry(resp, nil, 2) {
+		t.Errorf("expected attempt 2 to be retried")
+	}
+	if policy.ShouldRetry(resp, nil, 3) {
+		t.Errorf("expected attempt 3 not to be retried")
+	}
+	if policy.ShouldRetry(&http.Response{StatusCode: http.StatusInternalServerError}, nil, 1) {
+		t.Errorf("expected status code 500 not to be retried")
+	}
+	if !policy.ShouldRetry(nil, errors.New("connection refused"), 1) {
+		t.Errorf("expected connection errors to be retried")
+	}
+	if policy.ShouldRetry(nil, context.Canceled, 1) {
+		t.Errorf("expected cancelled requests not to be retried")
+	}
+}
+
+func TestDecorrelatedJitter(t *testing.T) {
+	policy := &DecorrelatedJitter{Base: 100 * time.Millisecond, Max: 2 * time.Second}
+
+	for attempt := 1; attempt < 10; attempt++ {
+		for i := 0; i < 20; i++ {
+			wait := policy.Backoff(attempt)
+			if wait < policy.Base || wait > policy.Max {
+				t.Errorf("expected backoff for attempt %d between %v and %v, got %v", attempt, policy.Base, policy.Max, wait)
+			}
+		}
+	}
+}
+
+type statusPolicy struct {
+	waits []time.Duration
+}
+
+func (p *statusPolicy) ShouldRetry(resp *http.Response, err error, attempt int) bool {
+	return resp != nil && resp.StatusCode == http.StatusConflict && attempt <= len(p.waits)
+}
+
+func (p *statusPolicy) Backoff(attempt int) time.Duration {
+	return p.waits[attempt-1]
+}
+
+func TestCustomRetryPolicy(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	clock := newFakeClock()
+	var retried []int
+	client := New(Opt{BaseURL: server.URL}).
+		SetClock(clock).
+		UseRetryPolicy(&statusPolicy{waits: []time.Duration{time.Second, 3 * time.Second}}).
+		OnRetry(func(req *http.Request, resp *http.Response, err error, attempt int, wait time.Duration) {
+			retried = append(retried, attempt)
+		})
+
+	resp, err := client.Get("/test")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Attempts != 3 {
+		t.Errorf("expected status code 200 after 3 attempts, got %d after %d", resp.StatusCode, resp.Attempts)
+	}
+	if waits := clock.Waits(); len(waits) != 2 || waits[0] != time.Second || waits[1] != 3*time.Second {
+		t.Errorf("expected waits [1s 3s], got %v", waits)
+	}
+	if len(retried) != 2 || retried[0] != 1 || retried[1] != 2 {
+		t.Errorf("expected OnRetry for attempts [1 2], got %v", retried)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	clock := newFakeClock()
+	client := New(Opt{BaseURL: server.URL}).
+		SetClock(clock).
+		UseRetryPolicy(&ConstantBackoff{MaxRetries: 10, Wait: 4 * time.Second}).
+		SetRetryBudget(10 * time.Second)
+
+	resp, err := client.Get("/test")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected status code 503, got %d", resp.StatusCode)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls within the budget, got %d", calls)
+	}
+}
+
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	waits []time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.waits = append(c.waits, d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func (c *fakeClock) Waits() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration(nil), c.waits...)
+}
@@ -0,0 +1,260 @@
+package vortex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultSegmentRetries is how often a failed segment is retried when no
+// retry count is configured.
+const defaultSegmentRetries = 3
+
+// SetDownloadSegments makes downloads fetch n byte ranges concurrently and
+// assemble them into the output file. Servers that do not advertise
+// Accept-Ranges: bytes are downloaded in a single stream.
+func (c *Client) SetDownloadSegments(n int) *Client {
+	c.segments = n
+	return c
+}
+
+// SetDownloadSegments makes the download fetch n byte ranges concurrently
+// and assemble them into the output file. Servers that do not advertise
+// Accept-Ranges: bytes are downloaded in a single stream.
+func (r *Request) SetDownloadSegments(n int) *Request {
+	r.segments = n
+	return r
+}
+
+// downloadSegmented probes the resource with HEAD and downloads it in
+// segments, or falls back to a single GET when ranges are not supported.
+func (r *Request) downloadSegmented(endpoint string) (*Response, error) {
+	start := time.Now()
+
+	probe := *r
+	probe.outputFile = ""
+	probe.segments = 0
+	probe.checksum = nil
+	probe.streamHandler = nil
+	probe.errorOnStatus = false
+	probe.progress.download = nil
+	head, err := probe.execute(http.MethodHead, endpoint, nil)
+	if err != nil {
+		if ctxErr := r.Context().Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+	}
+
+	single := *r
+	single.segments = 0
+	if err != nil || !head.IsSuccess() || head.Header("Accept-Ranges") != "bytes" || head.ContentLength <= 0 {
+		return single.execute(http.MethodGet, endpoint, nil)
+	}
+
+	size := head.ContentLength
+	segments := int64(r.segments)
+	if segments > size {
+		segments = size
+	}
+	validator := head.Header("ETag")
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		validator = head.Header("Last-Modified")
+	}
+
+	file, err := os.OpenFile(partPath(r.outputFile), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		removeDownload(r.outputFile)
+		return nil, err
+	}
+
+	var tracker *progressTracker
+	if r.progress.download != nil {
+		tracker = r.newProgressTracker(size, r.progress.download)
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	url := r.client.baseURL + endpoint
+	attempts := make([]int, segments)
+	errs := make([]error, segments)
+	var wg sync.WaitGroup
+	for i := int64(0); i < segments; i++ {
+		wg.Add(1)
+		go func(i int64) {
+			defer wg.Done()
+			from, to := size*i/segments, size*(i+1)/segments-1
+			attempts[i], errs[i] = r.downloadSegment(ctx, url, file, from, to, validator, tracker)
+			if errs[i] != nil {
+				cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	err = firstSegmentError(errs)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		removeDownload(r.outputFile)
+		return nil, err
+	}
+
+	response := &Response{
+		StatusCode:    http.StatusOK,
+		Status:        "200 OK",
+		Output:        r.output,
+		ErrorOutput:   r.errorOutput,
+		Headers:       head.Headers,
+		Cookies:       head.Cookies,
+		Proto:         head.Proto,
+		ContentLength: size,
+		FinalURL:      head.FinalURL,
+		TLS:           head.TLS,
+		Attempts:      head.Attempts,
+		Duration:      time.Since(start),
+		File:          r.outputFile,
+		Segments:      int(segments),
+	}
+	record := *head.Request
+	record.Method = http.MethodGet
+	record.outputFile = r.outputFile
+	response.Request = &record
+	for _, n := range attempts {
+		response.Attempts += n
+	}
+
+	if r.checksum != nil {
+		r.checksum.Reset()
+		if err := hashFile(r.checksum, partPath(r.outputFile), size); err != nil {
+			removeDownload(r.outputFile)
+			return nil, err
+		}
+		if err := r.verifyChecksum(); err != nil {
+			return response, err
+		}
+	}
+
+	if err := os.Rename(partPath(r.outputFile), r.outputFile); err != nil {
+		return nil, err
+	}
+	os.Remove(metaPath(r.outputFile))
+	return response, nil
+}
+
+// downloadSegment writes the bytes from-to of url into file. A segment
+// that fails is retried from the last byte written.
+func (r *Request) downloadSegment(ctx context.Context, url string, file *os.File, from, to int64, validator string, tracker *progressTracker) (int, error) {
+	retries := r.retry.count
+	if retries == 0 {
+		retries = defaultSegmentRetries
+	}
+
+	var attempts int
+	for attempt := 1; ; attempt++ {
+		n, tries, err := r.fetchRange(ctx, url, file, from, to, validator, tracker)
+		attempts += tries
+		from += n
+		if err == nil && from > to {
+			return attempts, nil
+		}
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		var signatureErr *SignatureError
+		if attempt > retries || ctx.Err() != nil || errors.As(err, &signatureErr) {
+			return attempts, err
+		}
+		if err := sleep(ctx, r.client.clock, r.retry.retryPolicy().Backoff(attempt)); err != nil {
+			return attempts, err
+		}
+	}
+}
+
+// fetchRange requests the bytes from-to of url, verifies the response
+// headers when VerifyResponses is set and copies what arrives into file,
+// returning how many bytes were written.
+func (r *Request) fetchRange(ctx context.Context, url string, file *os.File, from, to int64, validator string, tracker *progressTracker) (int64, int, error) {
+	reqCtx, cancel, watchBody := r.withReadTimeout(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	r.setRequestHeaders(req, &requestBody{})
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", from, to))
+	if validator != "" {
+		req.Header.Set("If-Range", validator)
+	}
+
+	var exec execution
+	resp, err := r.do(r.httpClient(), req, &exec)
+	if err != nil {
+		return 0, exec.attempts, newTransportError(req, contextError(ctx, r.timeoutError(err)))
+	}
+	watchBody(resp)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, exec.attempts, &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || start != from {
+		return 0, exec.attempts, fmt.Errorf("vortex: unexpected Content-Range %q for bytes %d-%d", resp.Header.Get("Content-Range"), from, to)
+	}
+	if err := r.verifyResponse(resp, nil); err != nil {
+		return 0, exec.attempts, err
+	}
+
+	var body io.Reader = resp.Body
+	if tracker != nil {
+		body = &progressReader{ReadCloser: resp.Body, tracker: tracker}
+	}
+	n, err := io.Copy(&offsetWriter{file: file, offset: from}, io.LimitReader(body, to-from+1))
+	if err != nil {
+		return n, exec.attempts, newTransportError(req, contextError(ctx, r.timeoutError(err)))
+	}
+	return n, exec.attempts, nil
+}
+
+// firstSegmentError returns the error that made the download fail, rather
+// than the cancellations it caused in the other segments.
+func firstSegmentError(errs []error) error {
+	var first error
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, context.Canceled) {
+			return err
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+type offsetWriter struct {
+	file   *os.File
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.file.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
@@ -0,0 +1,192 @@
+package vortex
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rangeServer serves content with byte range support and records the
+// Range header of every GET. When fail returns true for a GET, the
+// response is cut off after its first ten bytes.
+type rangeServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	ranges []string
+}
+
+func newRangeServer(content string, fail func(from int64, count int) bool) *rangeServer {
+	s := &rangeServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Method == http.MethodGet && fail != nil {
+			var from, to int64
+			fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &from, &to)
+
+			s.mu.Lock()
+			s.ranges = append(s.ranges, r.Header.Get("Range"))
+			count := 0
+			for _, seen := range s.ranges {
+				if strings.HasPrefix(seen, fmt.Sprintf("bytes=%d-", from)) {
+					count++
+				}
+			}
+			s.mu.Unlock()
+
+			if fail(from, count) {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", from, to, len(content)))
+				w.Header().Set("Content-Length", fmt.Sprint(to-from+1))
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write([]byte(content[from : from+10]))
+				w.(http.Flusher).Flush()
+				panic(http.ErrAbortHandler)
+			}
+		} else if r.Method == http.MethodGet {
+			s.mu.Lock()
+			s.ranges = append(s.ranges, r.Header.Get("Range"))
+			s.mu.Unlock()
+		}
+		http.ServeContent(w, r, "artifact.bin", time.Time{}, strings.NewReader(content))
+	}))
+	return s
+}
+
+func (s *rangeServer) Ranges() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.ranges...)
+}
+
+func segmentContent() string {
+	var b strings.Builder
+	for i := 0; b.Len() < 100000; i++ {
+		fmt.Fprintf(&b, "%08d\n", i)
+	}
+	return b.String()
+}
+
+func TestSegmentedDownload(t *testing.T) {
+	content := segmentContent()
+	server := newRangeServer(content, nil)
+	defer server.Close()
+
+	var progress progressRecorder
+	path := filepath.Join(t.TempDir(), "artifact.bin")
+	resp, err := New(Opt{BaseURL: server.URL}).R().
+		SetDownloadSegments(4).
+		OnDownloadProgress(progress.record).
+		Download("/artifact", path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	assertFile(t, path, content)
+
+	if resp.Segments != 4 || resp.File != path || resp.ContentLength != int64(len(content)) {
+		t.Errorf("expected a summary of 4 segments of %d bytes, got %+v", len(content), resp)
+	}
+	if resp.Attempts != 5 {
+		t.Errorf("expected 5 attempts including the probe, got %d", resp.Attempts)
+	}
+	ranges := server.Ranges()
+	if len(ranges) != 4 {
+		t.Fatalf("expected 4 range requests, got %v", ranges)
+	}
+	for _, rangeHeader := range ranges {
+		if !strings.HasPrefix(rangeHeader, "bytes=") {
+			t.Errorf("expected a Range header, got %q", rangeHeader)
+		}
+	}
+
+	reports := progress.Reports()
+	last := reports[len(reports)-1]
+	if !last.Done || last.Transferred != int64(len(content)) || last.Total != int64(len(content)) {
+		t.Errorf("expected a final progress report over all segments, got %+v", last)
+	}
+}
+
+func TestSegmentedDownloadFallback(t *testing.T) {
+	content := segmentContent()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "artifact.bin")
+	resp, err := New(Opt{BaseURL: server.URL}).
+		SetDownloadSegments(4).
+		Download("/artifact", path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.Segments != 0 || resp.StatusCode != http.StatusOK {
+		t.Errorf("expected a single stream download, got %d segments and status %d", resp.Segments, resp.StatusCode)
+	}
+	assertFile(t, path, content)
+}
+
+func TestSegmentedDownloadRetriesSegment(t *testing.T) {
+	content := segmentContent()
+	server := newRangeServer(content, func(from int64, count int) bool {
+		return from == int64(len(content)/2) && count == 1
+	})
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "artifact.bin")
+	resp, err := New(Opt{BaseURL: server.URL}).
+		SetRetryWaitTime(time.Millisecond, time.Millisecond).
+		R().
+		SetDownloadSegments(2).
+		Download("/artifact", path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	assertFile(t, path, content)
+
+	resumed := false
+	for _, rangeHeader := range server.Ranges() {
+		if strings.HasPrefix(rangeHeader, "bytes=50014-") {
+			resumed = true
+		}
+	}
+	if !resumed {
+		t.Errorf("expected the failed segment to resume at byte 50014, got %v", server.Ranges())
+	}
+	if resp.Attempts != 4 {
+		t.Errorf("expected 4 attempts including the probe, got %d", resp.Attempts)
+	}
+}
+
+func TestSegmentedDownloadFails(t *testing.T) {
+	content := segmentContent()
+	server := newRangeServer(content, func(from int64, count int) bool {
+		return from < 50000
+	})
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "artifact.bin")
+	resp, err := New(Opt{BaseURL: server.URL}).
+		SetRetryWaitTime(time.Millisecond, time.Millisecond).
+		SetRetries(2).
+		R().
+		SetDownloadSegments(2).
+		Download("/artifact", path)
+	var transportErr *TransportError
+	if !errors.As(err, &transportErr) {
+		t.Fatalf("expected a *TransportError, got %v", err)
+	}
+	if resp != nil {
+		t.Errorf("expected no response, got %+v", resp)
+	}
+	for _, p := range []string{path, partPath(path)} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed, got %v", p, err)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package vortex
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// sfMember is a member of a structured field dictionary (RFC 8941), as used
+// by Content-Digest, Signature-Input and Signature.
+type sfMember struct {
+	key string
+	// raw is the serialized value together with its parameters.
+	raw    string
+	value  string
+	bytes  []byte
+	items  []sfItem
+	inner  bool
+	params map[string]string
+}
+
+type sfItem struct {
+	value  string
+	params map[string]string
+}
+
+type sfParser struct {
+	s string
+	i int
+}
+
+// parseDictionary parses a structured field dictionary. String values and
+// parameters are unquoted; byte sequences are decoded into bytes.
+func parseDictionary(s string) ([]sfMember, error) {
+	p := &sfParser{s: s}
+	var members []sfMember
+	p.skipSpace(" \t")
+	for p.i < len(p.s) {
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		member := sfMember{key: key, value: "?1"}
+		start := p.i
+		if p.peek() == '=' {
+			p.i++
+			start = p.i
+			if err := p.memberValue(&member); err != nil {
+				return nil, err
+			}
+		}
+		if member.params, err = p.parameters(); err != nil {
+			return nil, err
+		}
+		member.raw = p.s[start:p.i]
+		members = append(members, member)
+
+		p.skipSpace(" \t")
+		if p.i == len(p.s) {
+			break
+		}
+		if p.peek() != ',' {
+			return nil, p.errorf("expected ','")
+		}
+		p.i++
+		p.skipSpace(" \t")
+		if p.i == len(p.s) {
+			return nil, p.errorf("trailing ','")
+		}
+	}
+	return members, nil
+}
+
+func (p *sfParser) memberValue(member *sfMember) error {
+	if p.peek() != '(' {
+		value, bytes, err := p.bareItem()
+		member.value, member.bytes = value, bytes
+		return err
+	}
+	p.i++
+	member.inner = true
+	for {
+		p.skipSpace(" ")
+		if p.peek() == ')' {
+			p.i++
+			return nil
+		}
+		value, _, err := p.bareItem()
+		if err != nil {
+			return err
+		}
+		params, err := p.parameters()
+		if err != nil {
+			return err
+		}
+		member.items = append(member.items, sfItem{value: value, params: params})
+		if c := p.peek(); c != ' ' && c != ')' {
+			return p.errorf("expected ' ' or ')' in inner list")
+		}
+	}
+}
+
+func (p *sfParser) parameters() (map[string]string, error) {
+	var params map[string]string
+	for p.peek() == ';' {
+		p.i++
+		p.skipSpace(" ")
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		value := "?1"
+		if p.peek() == '=' {
+			p.i++
+			if value, _, err = p.bareItem(); err != nil {
+				return nil, err
+			}
+		}
+		if params == nil {
+			params = map[string]string{}
+		}
+		params[key] = value
+	}
+	return params, nil
+}
+
+func (p *sfParser) key() (string, error) {
+	start := p.i
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		if 'a' <= c && c <= 'z' || c == '*' || p.i > start && ('0' <= c && c <= '9' || c == '_' || c == '-' || c == '.') {
+			p.i++
+			continue
+		}
+		break
+	}
+	if p.i == start {
+		return "", p.errorf("expected a key")
+	}
+	return p.s[start:p.i], nil
+}
+
+// bareItem parses a string, byte sequence, boolean, number or token.
+func (p *sfParser) bareItem() (string, []byte, error) {
+	switch c := p.peek(); {
+	case c == '"':
+		p.i++
+		var b strings.Builder
+		for p.i < len(p.s) {
+			c := p.s[p.i]
+			p.i++
+			switch c {
+			case '\\':
+				if p.i == len(p.s) {
+					return "", nil, p.errorf("unterminated string")
+				}
+				b.WriteByte(p.s[p.i])
+				p.i++
+			case '"':
+				return b.String(), nil, nil
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", nil, p.errorf("unterminated string")
+	case c == ':':
+		end := strings.IndexByte(p.s[p.i+1:], ':')
+		if end < 0 {
+			return "", nil, p.errorf("unterminated byte sequence")
+		}
+		value := p.s[p.i+1 : p.i+1+end]
+		p.i += end + 2
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return "", nil, p.errorf("invalid byte sequence")
+		}
+		return value, decoded, nil
+	case c == '?' || c == '-' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '*':
+		start := p.i
+		p.i++
+		for p.i < len(p.s) && !strings.ContainsRune(" \t,;()=\"", rune(p.s[p.i])) {
+			p.i++
+		}
+		return p.s[start:p.i], nil, nil
+	}
+	return "", nil, p.errorf("expected an item")
+}
+
+func (p *sfParser) peek() byte {
+	if p.i < len(p.s) {
+		return p.s[p.i]
+	}
+	return 0
+}
+
+func (p *sfParser) skipSpace(chars string) {
+	for p.i < len(p.s) && strings.IndexByte(chars, p.s[p.i]) >= 0 {
+		p.i++
+	}
+}
+
+func (p *sfParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w at offset %d: %s", errMalformedField, p.i, fmt.Sprintf(format, args...))
+}
+
+var errMalformedField = errors.New("malformed structured field")
@@ -0,0 +1,31 @@
+package vortex
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseDictionary(t *testing.T) {
+	members, err := parseDictionary(`sig1=("@method" "@query-param";name="id");created=1;keyid="a b", sig2=:aGVsbG8=:, flag`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 3 {
+		t.Fatalf("expected 3 members, got %+v", members)
+	}
+	if members[0].raw != `("@method" "@query-param";name="id");created=1;keyid="a b"` || members[0].params["keyid"] != "a b" {
+		t.Errorf("expected the raw inner list and its parameters, got %+v", members[0])
+	}
+	if len(members[0].items) != 2 || members[0].items[1].params["name"] != "id" {
+		t.Errorf("expected two items with parameters, got %+v", members[0].items)
+	}
+	if string(members[1].bytes) != "hello" || members[2].value != "?1" {
+		t.Errorf("expected a byte sequence and a boolean, got %+v", members[1:])
+	}
+
+	for _, malformed := range []string{`sig1=("a"`, `sig1=:aGVsbG8`, `sig1=1,`, `Sig=1`} {
+		if _, err := parseDictionary(malformed); !errors.Is(err, errMalformedField) {
+			t.Errorf("expected %q to be malformed, got %v", malformed, err)
+		}
+	}
+}
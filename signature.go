@@ -0,0 +1,508 @@
+package vortex
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTP message signature algorithms from the RFC 9421 registry.
+const (
+	SignatureHMACSHA256      = "hmac-sha256"
+	SignatureEd25519         = "ed25519"
+	SignatureRSAPSSSHA512    = "rsa-pss-sha512"
+	SignatureECDSAP256SHA256 = "ecdsa-p256-sha256"
+	SignatureECDSAP384SHA384 = "ecdsa-p384-sha384"
+)
+
+// defaultSignatureLabel names the signature when no label is configured.
+const defaultSignatureLabel = "sig1"
+
+// SignatureKey is a key for HTTP message signatures. Key is a []byte secret
+// for HMAC, and an ed25519, *rsa or *ecdsa private key for signing or public
+// key for verifying.
+type SignatureKey struct {
+	ID        string
+	Algorithm string
+	Key       interface{}
+}
+
+// MessageSignatureConfig configures a MessageSigner.
+type MessageSignatureConfig struct {
+	// Label names the signature in Signature-Input and Signature, "sig1" by
+	// default.
+	Label string
+	Key   SignatureKey
+	// Components are the covered components: derived components such as
+	// "@method", "@target-uri", "@authority", "@path" and "@query", and
+	// lowercase header names. By default "@method", "@target-uri" and,
+	// when the request has one, "content-digest".
+	Components []string
+	// Expires sets the expires parameter this long after created.
+	Expires time.Duration
+	// Tag sets the tag parameter.
+	Tag string
+	// Clock is the source of the created time, the system clock by default.
+	Clock Clock
+}
+
+// MessageSigner signs requests with HTTP Message Signatures (RFC 9421).
+type MessageSigner struct {
+	config MessageSignatureConfig
+}
+
+func NewMessageSigner(config MessageSignatureConfig) *MessageSigner {
+	if config.Label == "" {
+		config.Label = defaultSignatureLabel
+	}
+	if config.Clock == nil {
+		config.Clock = realClock{}
+	}
+	return &MessageSigner{config: config}
+}
+
+// SetMessageSigner signs every request with signer just before it is sent,
+// after middleware, so that every attempt gets a fresh created time.
+func (c *Client) SetMessageSigner(signer *MessageSigner) *Client {
+	c.messageSigner = signer
+	return c
+}
+
+func (r *Request) SetMessageSigner(signer *MessageSigner) *Request {
+	r.messageSigner = signer
+	return r
+}
+
+// Sign adds the Signature-Input and Signature headers to req.
+func (s *MessageSigner) Sign(req *http.Request) error {
+	components := s.config.Components
+	if len(components) == 0 {
+		components = []string{"@method", "@target-uri"}
+		if req.Header.Get("Content-Digest") != "" {
+			components = append(components, "content-digest")
+		}
+	}
+
+	quoted := make([]string, len(components))
+	for i, component := range components {
+		quoted[i] = strconv.Quote(component)
+	}
+	created := s.config.Clock.Now()
+	params := fmt.Sprintf("(%s);created=%d", strings.Join(quoted, " "), created.Unix())
+	if s.config.Expires > 0 {
+		params += fmt.Sprintf(";expires=%d", created.Add(s.config.Expires).Unix())
+	}
+	if s.config.Key.ID != "" {
+		params += ";keyid=" + strconv.Quote(s.config.Key.ID)
+	}
+	params += ";alg=" + strconv.Quote(s.config.Key.Algorithm)
+	if s.config.Tag != "" {
+		params += ";tag=" + strconv.Quote(s.config.Tag)
+	}
+
+	base, err := signatureBase(httpMessage{req: req, header: req.Header}, components, params)
+	if err != nil {
+		return err
+	}
+	signature, err := signMessage(s.config.Key, []byte(base))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Signature-Input", s.config.Label+"="+params)
+	req.Header.Set("Signature", s.config.Label+"=:"+base64.StdEncoding.EncodeToString(signature)+":")
+	return nil
+}
+
+// messageSignerTransport signs requests just before they are sent.
+type messageSignerTransport struct {
+	next   http.RoundTripper
+	signer *MessageSigner
+}
+
+func (t *messageSignerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	signed := req.Clone(req.Context())
+	signed.Body = req.Body
+	if err := t.signer.Sign(signed); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(signed)
+}
+
+// MessageVerifierConfig configures a MessageVerifier.
+type MessageVerifierConfig struct {
+	// Keys are the keys signatures may use, by key ID. A single key is
+	// also used for signatures without a keyid.
+	Keys []SignatureKey
+	// Label selects the signature to verify. By default the first one is.
+	Label string
+	// Required are components the signature must cover, e.g. "@status" or
+	// "content-digest".
+	Required []string
+	// MaxAge rejects signatures created longer ago. 0 accepts any age.
+	MaxAge time.Duration
+	// Clock is the source of the current time, the system clock by
+	// default.
+	Clock Clock
+}
+
+// MessageVerifier verifies HTTP Message Signatures (RFC 9421) on responses
+// and requests, and the Content-Digest of their bodies.
+type MessageVerifier struct {
+	config MessageVerifierConfig
+}
+
+func NewMessageVerifier(config MessageVerifierConfig) *MessageVerifier {
+	if config.Clock == nil {
+		config.Clock = realClock{}
+	}
+	return &MessageVerifier{config: config}
+}
+
+// VerifyResponses verifies the signature of every response with verifier.
+// A response that fails is returned together with a *SignatureError, or a
+// *DigestError when its Content-Digest does not match the body. Streamed,
+// downloaded and Stream or SSE responses are verified before their body is
+// read, so their Content-Digest is not checked and a failing body never
+// reaches the caller or the file.
+func (c *Client) VerifyResponses(verifier *MessageVerifier) *Client {
+	c.verifier = verifier
+	return c
+}
+
+func (r *Request) VerifyResponses(verifier *MessageVerifier) *Request {
+	r.verifier = verifier
+	return r
+}
+
+// SignatureError is returned when a message signature is missing or does
+// not verify.
+type SignatureError struct {
+	Label  string
+	Reason string
+}
+
+func (e *SignatureError) Error() string {
+	if e.Label == "" {
+		return "vortex: signature: " + e.Reason
+	}
+	return fmt.Sprintf("vortex: signature %q: %s", e.Label, e.Reason)
+}
+
+// VerifyResponse verifies the signature of resp and, when the header is
+// present and body is not nil, the Content-Digest of body.
+func (v *MessageVerifier) VerifyResponse(resp *http.Response, body []byte) error {
+	return v.verify(httpMessage{resp: resp, header: resp.Header}, body)
+}
+
+// VerifyRequest verifies the signature of req and, when the header is
+// present and body is not nil, the Content-Digest of body. It is meant for
+// servers receiving signed requests.
+func (v *MessageVerifier) VerifyRequest(req *http.Request, body []byte) error {
+	return v.verify(httpMessage{req: req, header: req.Header}, body)
+}
+
+func (v *MessageVerifier) verify(msg httpMessage, body []byte) error {
+	inputs, err := parseDictionary(strings.Join(msg.header.Values("Signature-Input"), ", "))
+	if err != nil {
+		return &SignatureError{Reason: "Signature-Input: " + err.Error()}
+	}
+	signatures, err := parseDictionary(strings.Join(msg.header.Values("Signature"), ", "))
+	if err != nil {
+		return &SignatureError{Reason: "Signature: " + err.Error()}
+	}
+
+	var input *sfMember
+	for i := range inputs {
+		if v.config.Label == "" || inputs[i].key == v.config.Label {
+			input = &inputs[i]
+			break
+		}
+	}
+	if input == nil {
+		return &SignatureError{Label: v.config.Label, Reason: "no Signature-Input"}
+	}
+	label := input.key
+	if !input.inner {
+		return &SignatureError{Label: label, Reason: "Signature-Input is not an inner list"}
+	}
+	var signature []byte
+	for _, member := range signatures {
+		if member.key == label {
+			signature = member.bytes
+		}
+	}
+	if signature == nil {
+		return &SignatureError{Label: label, Reason: "no Signature"}
+	}
+
+	components := make([]string, len(input.items))
+	for i, item := range input.items {
+		if len(item.params) > 0 {
+			return &SignatureError{Label: label, Reason: fmt.Sprintf("component %q has unsupported parameters", item.value)}
+		}
+		components[i] = item.value
+	}
+	for _, required := range v.config.Required {
+		if !containsString(components, required) {
+			return &SignatureError{Label: label, Reason: fmt.Sprintf("required component %q is not covered", required)}
+		}
+	}
+
+	now := v.config.Clock.Now()
+	if expires, ok := input.params["expires"]; ok {
+		if unix, err := strconv.ParseInt(expires, 10, 64); err != nil || now.After(time.Unix(unix, 0)) {
+			return &SignatureError{Label: label, Reason: "signature has expired"}
+		}
+	}
+	if v.config.MaxAge > 0 {
+		created, err := strconv.ParseInt(input.params["created"], 10, 64)
+		if err != nil {
+			return &SignatureError{Label: label, Reason: "signature has no created time"}
+		}
+		if now.Sub(time.Unix(created, 0)) > v.config.MaxAge {
+			return &SignatureError{Label: label, Reason: "signature is too old"}
+		}
+	}
+
+	key, err := v.key(input.params["keyid"])
+	if err != nil {
+		return &SignatureError{Label: label, Reason: err.Error()}
+	}
+	if alg, ok := input.params["alg"]; ok && alg != key.Algorithm {
+		return &SignatureError{Label: label, Reason: fmt.Sprintf("algorithm %q does not match key %q", alg, key.ID)}
+	}
+
+	base, err := signatureBase(msg, components, input.raw)
+	if err != nil {
+		return &SignatureError{Label: label, Reason: err.Error()}
+	}
+	if err := verifyMessage(key, []byte(base), signature); err != nil {
+		return &SignatureError{Label: label, Reason: err.Error()}
+	}
+
+	if body != nil {
+		return verifyBodyDigest(msg.header, body)
+	}
+	return nil
+}
+
+func (v *MessageVerifier) key(id string) (SignatureKey, error) {
+	if id == "" && len(v.config.Keys) == 1 {
+		return v.config.Keys[0], nil
+	}
+	for _, key := range v.config.Keys {
+		if key.ID == id {
+			return key, nil
+		}
+	}
+	return SignatureKey{}, fmt.Errorf("unknown key %q", id)
+}
+
+// httpMessage is the request or response whose components are signed.
+type httpMessage struct {
+	req    *http.Request
+	resp   *http.Response
+	header http.Header
+}
+
+// signatureBase builds the signature base of RFC 9421 section 2.5.
+func signatureBase(msg httpMessage, components []string, params string) (string, error) {
+	var b strings.Builder
+	for _, component := range components {
+		value, err := msg.component(component)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(strconv.Quote(component) + ": " + value + "\n")
+	}
+	b.WriteString(`"@signature-params": ` + params)
+	return b.String(), nil
+}
+
+func (m httpMessage) component(name string) (string, error) {
+	if !strings.HasPrefix(name, "@") {
+		values := m.header.Values(name)
+		if len(values) == 0 {
+			return "", fmt.Errorf("component %q is not present", name)
+		}
+		trimmed := make([]string, len(values))
+		for i, value := range values {
+			trimmed[i] = strings.TrimSpace(value)
+		}
+		return strings.Join(trimmed, ", "), nil
+	}
+
+	if name == "@status" {
+		if m.resp == nil {
+			return "", errors.New(`component "@status" is only defined for responses`)
+		}
+		return strconv.Itoa(m.resp.StatusCode), nil
+	}
+	if m.req == nil {
+		return "", fmt.Errorf("component %q is only supported for requests", name)
+	}
+	u := m.req.URL
+	switch name {
+	case "@method":
+		return m.req.Method, nil
+	case "@target-uri":
+		target := *u
+		if target.Host == "" {
+			target.Host = m.req.Host
+		}
+		if target.Scheme == "" {
+			target.Scheme = "https"
+			if m.req.TLS == nil {
+				target.Scheme = "http"
+			}
+		}
+		return target.String(), nil
+	case "@authority":
+		host := m.req.Host
+		if host == "" {
+			host = u.Host
+		}
+		return strings.ToLower(host), nil
+	case "@scheme":
+		return strings.ToLower(u.Scheme), nil
+	case "@request-target":
+		return u.RequestURI(), nil
+	case "@path":
+		if path := u.EscapedPath(); path != "" {
+			return path, nil
+		}
+		return "/", nil
+	case "@query":
+		return "?" + u.RawQuery, nil
+	}
+	return "", fmt.Errorf("unsupported component %q", name)
+}
+
+func signMessage(key SignatureKey, base []byte) ([]byte, error) {
+	switch key.Algorithm {
+	case SignatureHMACSHA256:
+		secret, ok := key.Key.([]byte)
+		if !ok {
+			return nil, errors.New("vortex: hmac-sha256 needs a []byte key")
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(base)
+		return mac.Sum(nil), nil
+	case SignatureEd25519:
+		private, ok := key.Key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("vortex: ed25519 needs an ed25519.PrivateKey")
+		}
+		return ed25519.Sign(private, base), nil
+	case SignatureRSAPSSSHA512:
+		private, ok := key.Key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("vortex: rsa-pss-sha512 needs an *rsa.PrivateKey")
+		}
+		digest := sha512.Sum512(base)
+		return rsa.SignPSS(rand.Reader, private, crypto.SHA512, digest[:], &rsa.PSSOptions{SaltLength: 64})
+	case SignatureECDSAP256SHA256, SignatureECDSAP384SHA384:
+		private, ok := key.Key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("vortex: %s needs an *ecdsa.PrivateKey", key.Algorithm)
+		}
+		digest, size := ecdsaDigest(key.Algorithm, base)
+		r, s, err := ecdsa.Sign(rand.Reader, private, digest)
+		if err != nil {
+			return nil, err
+		}
+		signature := make([]byte, 2*size)
+		r.FillBytes(signature[:size])
+		s.FillBytes(signature[size:])
+		return signature, nil
+	}
+	return nil, fmt.Errorf("vortex: unsupported signature algorithm %q", key.Algorithm)
+}
+
+func verifyMessage(key SignatureKey, base, signature []byte) error {
+	public := key.Key
+	if signer, ok := public.(crypto.Signer); ok {
+		public = signer.Public()
+	}
+
+	switch key.Algorithm {
+	case SignatureHMACSHA256:
+		expected, err := signMessage(key, base)
+		if err != nil {
+			return err
+		}
+		if !hmac.Equal(expected, signature) {
+			return errors.New("signature does not match")
+		}
+		return nil
+	case SignatureEd25519:
+		publicKey, ok := public.(ed25519.PublicKey)
+		if !ok {
+			return errors.New("ed25519 needs an ed25519.PublicKey")
+		}
+		if !ed25519.Verify(publicKey, base, signature) {
+			return errors.New("signature does not match")
+		}
+		return nil
+	case SignatureRSAPSSSHA512:
+		publicKey, ok := public.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("rsa-pss-sha512 needs an *rsa.PublicKey")
+		}
+		digest := sha512.Sum512(base)
+		if err := rsa.VerifyPSS(publicKey, crypto.SHA512, digest[:], signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto}); err != nil {
+			return errors.New("signature does not match")
+		}
+		return nil
+	case SignatureECDSAP256SHA256, SignatureECDSAP384SHA384:
+		publicKey, ok := public.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%s needs an *ecdsa.PublicKey", key.Algorithm)
+		}
+		digest, size := ecdsaDigest(key.Algorithm, base)
+		if len(signature) != 2*size {
+			return errors.New("signature has the wrong length")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(publicKey, digest, r, s) {
+			return errors.New("signature does not match")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported signature algorithm %q", key.Algorithm)
+}
+
+// ecdsaDigest hashes base for the ECDSA algorithm and returns the size of
+// r and s in its signatures.
+func ecdsaDigest(algorithm string, base []byte) ([]byte, int) {
+	if algorithm == SignatureECDSAP384SHA384 {
+		digest := sha512.Sum384(base)
+		return digest[:], (elliptic.P384().Params().BitSize + 7) / 8
+	}
+	digest := sha256.Sum256(base)
+	return digest[:], (elliptic.P256().Params().BitSize + 7) / 8
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
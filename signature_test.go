@@ -0,0 +1,266 @@
+package vortex
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestVerifyRequestRFCExample(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com/foo?param=Value&Pet=dog", strings.NewReader(`{"hello": "world"}`))
+	req.Header.Set("Date", "Tue, 20 Apr 2021 02:07:55 GMT")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Digest", "sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:")
+	req.Header.Set("Signature-Input", `sig-b25=("date" "@authority" "content-type");created=1618884473;keyid="test-shared-secret"`)
+	req.Header.Set("Signature", "sig-b25=:pxcQw6G3AjtMBQjwo8XzkZf/bws5LelbaMk5rGIGtE8=:")
+
+	secret, _ := base64.StdEncoding.DecodeString("uzvJfB4u3N0Jy4T7NZ75MDVcr8zSTInedJtkgcu46YW4XByzNJjxBdtjUkdJPBtbmHhIDi6pcl8jsasjlTMtDQ==")
+	verifier := NewMessageVerifier(MessageVerifierConfig{
+		Keys: []SignatureKey{{ID: "test-shared-secret", Algorithm: SignatureHMACSHA256, Key: secret}},
+	})
+	if err := verifier.VerifyRequest(req, []byte(`{"hello": "world"}`)); err != nil {
+		t.Errorf("expected the RFC 9421 example to verify, got %v", err)
+	}
+
+	req.Header.Set("Content-Type", "text/plain")
+	var signatureErr *SignatureError
+	if err := verifier.VerifyRequest(req, nil); !errors.As(err, &signatureErr) || signatureErr.Label != "sig-b25" {
+		t.Errorf("expected a *SignatureError for a changed header, got %v", err)
+	}
+}
+
+func signatureTestKeys(t *testing.T) []SignatureKey {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256Key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384Key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	return []SignatureKey{
+		{ID: "hmac", Algorithm: SignatureHMACSHA256, Key: []byte("shared secret")},
+		{ID: "ed25519", Algorithm: SignatureEd25519, Key: edKey},
+		{ID: "rsa", Algorithm: SignatureRSAPSSSHA512, Key: rsaKey},
+		{ID: "p256", Algorithm: SignatureECDSAP256SHA256, Key: p256Key},
+		{ID: "p384", Algorithm: SignatureECDSAP384SHA384, Key: p384Key},
+	}
+}
+
+func TestMessageSigner(t *testing.T) {
+	keys := signatureTestKeys(t)
+	verifier := NewMessageVerifier(MessageVerifierConfig{
+		Keys:     keys,
+		Required: []string{"@method", "@target-uri", "content-digest"},
+		MaxAge:   time.Minute,
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := verifier.VerifyRequest(r, body); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, err)
+		}
+	}))
+	defer server.Close()
+
+	for _, key := range keys {
+		t.Run(key.Algorithm, func(t *testing.T) {
+			resp, err := New(Opt{BaseURL: server.URL}).
+				SetContentDigest(DigestSHA256).
+				SetMessageSigner(NewMessageSigner(MessageSignatureConfig{Key: key, Tag: "partner"})).
+				Post("/orders?page=1", map[string]string{"id": "1"})
+			if err != nil || resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected the signed request to verify, got %v, %v", resp, err)
+			}
+		})
+	}
+
+	resp, err := New(Opt{BaseURL: server.URL}).
+		SetMessageSigner(NewMessageSigner(MessageSignatureConfig{Key: keys[0]})).
+		Post("/orders", map[string]string{"id": "1"})
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || !strings.Contains(string(resp.Body), `required component "content-digest" is not covered`) {
+		t.Errorf("expected a signature without content-digest to be rejected, got %v, %v", resp, err)
+	}
+}
+
+// signResponse signs the status and headers of a test server response.
+func signResponse(t *testing.T, w http.ResponseWriter, key SignatureKey, status int, params string) {
+	components := []string{"@status", "content-type", "content-digest"}
+	params = `("@status" "content-type" "content-digest")` + params
+	base, err := signatureBase(httpMessage{resp: &http.Response{StatusCode: status}, header: w.Header()}, components, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := signMessage(key, []byte(base))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Header().Set("Signature-Input", "res="+params)
+	w.Header().Set("Signature", "res=:"+base64.StdEncoding.EncodeToString(signature)+":")
+}
+
+func TestVerifyResponses(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	signing := SignatureKey{ID: "server", Algorithm: SignatureEd25519, Key: key}
+	clock := newFakeClock()
+	created := clock.Now().Unix()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := `{"hello": "world"}`
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Digest", "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:")
+		signResponse(t, w, signing, http.StatusOK, fmt.Sprintf(`;created=%d;keyid="server"`, created))
+		if r.URL.Path == "/tampered" {
+			body = `{"hello": "mallory"}`
+		}
+		if r.URL.Path == "/expired" {
+			signResponse(t, w, signing, http.StatusOK, fmt.Sprintf(`;created=%d;expires=%d;keyid="server"`, created-60, created-30))
+		}
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+
+	var output map[string]string
+	verifier := NewMessageVerifier(MessageVerifierConfig{
+		Keys:     []SignatureKey{{ID: "server", Algorithm: SignatureEd25519, Key: key.Public()}},
+		Label:    "res",
+		Required: []string{"@status", "content-digest"},
+		Clock:    clock,
+	})
+	client := New(Opt{BaseURL: server.URL}).VerifyResponses(verifier)
+
+	if _, err := client.R().SetOutput(&output).Get("/"); err != nil || output["hello"] != "world" {
+		t.Fatalf("expected the signed response to verify, got %v, %v", output, err)
+	}
+
+	var digestErr *DigestError
+	if _, err := client.Get("/tampered"); !errors.As(err, &digestErr) {
+		t.Errorf("expected a *DigestError for a tampered body, got %v", err)
+	}
+
+	var signatureErr *SignatureError
+	if _, err := client.Get("/expired"); !errors.As(err, &signatureErr) || signatureErr.Reason != "signature has expired" {
+		t.Errorf("expected an expired *SignatureError, got %v", err)
+	}
+
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	_, err := client.R().VerifyResponses(NewMessageVerifier(MessageVerifierConfig{
+		Keys: []SignatureKey{{ID: "server", Algorithm: SignatureEd25519, Key: other.Public()}},
+	})).Get("/")
+	if !errors.As(err, &signatureErr) || signatureErr.Reason != "signature does not match" {
+		t.Errorf("expected a *SignatureError for the wrong key, got %v", err)
+	}
+}
+
+func TestVerifyResponsesBeforeHandingOn(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/events" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: unsigned\n\n")
+			return
+		}
+		fmt.Fprint(w, "unsigned")
+		if r.URL.Path == "/stream" {
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}
+	}))
+
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	client := New(Opt{BaseURL: server.URL}).VerifyResponses(NewMessageVerifier(MessageVerifierConfig{
+		Keys: []SignatureKey{{ID: "server", Algorithm: SignatureEd25519, Key: key.Public()}},
+	}))
+
+	var signatureErr *SignatureError
+	resp, err := client.R().Streaming().Get("/stream")
+	if !errors.As(err, &signatureErr) {
+		t.Errorf("expected a *SignatureError for an unsigned stream, got %v", err)
+	}
+	if resp == nil || resp.RawBody != nil {
+		t.Errorf("expected the response without its body, got %+v", resp)
+	}
+
+	handled := false
+	_, err = client.R().Stream(func(resp *http.Response) error {
+		handled = true
+		return nil
+	}).Get("/")
+	if !errors.As(err, &signatureErr) || handled {
+		t.Errorf("expected a *SignatureError before the stream handler runs, got %v, handled %v", err, handled)
+	}
+
+	err = client.R().SSE("/events", func(event Event) error {
+		t.Errorf("expected no unverified event, got %+v", event)
+		return errDone
+	})
+	if !errors.As(err, &signatureErr) {
+		t.Errorf("expected SSE to stop with a *SignatureError, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "report.csv")
+	if _, err := client.R().Download("/", path); !errors.As(err, &signatureErr) {
+		t.Errorf("expected a *SignatureError for an unsigned download, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected no file for an unsigned download, got %v", err)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		server.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the stream connection to be closed")
+	}
+}
+
+func TestVerifyResponsesSegmentedDownload(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	signing := SignatureKey{ID: "server", Algorithm: SignatureEd25519, Key: key}
+	content := strings.Repeat("0123456789", 100)
+	var ranges int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		if r.Method == http.MethodHead {
+			// Only the probe is signed, not the ranges that are written.
+			w.Header().Set("Content-Digest", "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:")
+			signResponse(t, w, signing, http.StatusOK, fmt.Sprintf(`;created=%d;keyid="server"`, time.Now().Unix()))
+		} else {
+			atomic.AddInt32(&ranges, 1)
+		}
+		http.ServeContent(w, r, "data.txt", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	client := New(Opt{BaseURL: server.URL}).VerifyResponses(NewMessageVerifier(MessageVerifierConfig{
+		Keys: []SignatureKey{{ID: "server", Algorithm: SignatureEd25519, Key: key.Public()}},
+	}))
+	path := filepath.Join(t.TempDir(), "data.txt")
+	_, err := client.R().SetDownloadSegments(4).Download("/", path)
+	var signatureErr *SignatureError
+	if !errors.As(err, &signatureErr) {
+		t.Fatalf("expected a *SignatureError for unsigned ranges, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected no file for unsigned ranges, got %v", err)
+	}
+	if n := atomic.LoadInt32(&ranges); n > 4 {
+		t.Errorf("expected failed ranges not to be retried, got %d range requests", n)
+	}
+}
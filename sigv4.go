@@ -0,0 +1,475 @@
+package vortex
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sigV4Algorithm       = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat      = "20060102T150405Z"
+	sigV4DateFormat      = "20060102"
+	sigV4Unsigned        = "UNSIGNED-PAYLOAD"
+	sigV4Streaming       = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	sigV4ChunkSignature  = ";chunk-signature="
+	defaultSigV4Chunk    = 64 << 10
+	sigV4SignatureLength = 64
+)
+
+// sigV4IgnoredHeaders are not signed because proxies and the transport may
+// change them.
+var sigV4IgnoredHeaders = map[string]bool{
+	"authorization":   true,
+	"user-agent":      true,
+	"x-amzn-trace-id": true,
+	"expect":          true,
+}
+
+// AWSCredentials are the keys requests are signed with. SessionToken is
+// set for temporary credentials.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// SigV4Payload selects how the request body is covered by the signature.
+type SigV4Payload int
+
+const (
+	// SigV4SignedPayload hashes the whole body. The body must be
+	// replayable, which all bodies except one-shot readers are.
+	SigV4SignedPayload SigV4Payload = iota
+	// SigV4UnsignedPayload leaves the body out of the signature.
+	SigV4UnsignedPayload
+	// SigV4StreamingPayload signs the body in chunks as it is sent, using
+	// aws-chunked encoding. The body length must be known.
+	SigV4StreamingPayload
+)
+
+// SigV4Config configures a SigV4Signer.
+type SigV4Config struct {
+	Credentials AWSCredentials
+	Region      string
+	Service     string
+	Payload     SigV4Payload
+	// ChunkSize is the chunk size of streaming payloads, 64 KiB by default.
+	ChunkSize int
+	// Clock is the source of the signing time, the system clock by default.
+	Clock Clock
+}
+
+// SigV4Signer signs requests with AWS Signature Version 4.
+type SigV4Signer struct {
+	config SigV4Config
+}
+
+func NewSigV4Signer(config SigV4Config) *SigV4Signer {
+	if config.ChunkSize <= 0 {
+		config.ChunkSize = defaultSigV4Chunk
+	}
+	if config.Clock == nil {
+		config.Clock = realClock{}
+	}
+	return &SigV4Signer{config: config}
+}
+
+// SetSigV4 signs every request with signer. Signing happens after
+// middleware, just before the request is sent, so every attempt is signed
+// with a fresh date. When upload progress is tracked, a signed payload is
+// hashed before middleware runs, so middleware must not replace the body.
+func (c *Client) SetSigV4(signer *SigV4Signer) *Client {
+	c.sigV4 = signer
+	return c
+}
+
+func (r *Request) SetSigV4(signer *SigV4Signer) *Request {
+	r.sigV4 = signer
+	return r
+}
+
+// Presign returns a presigned URL for method and endpoint, including the
+// request query parameters, that is valid for expires.
+func (r *Request) Presign(method, endpoint string, expires time.Duration) (string, error) {
+	if r.sigV4 == nil {
+		return "", errors.New("vortex: Presign needs a SigV4 signer")
+	}
+	req, err := http.NewRequestWithContext(r.Context(), method, r.client.baseURL+endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	if len(r.QueryParams) > 0 {
+		req.URL.RawQuery = r.QueryParams.Encode()
+	}
+	u, err := r.sigV4.Presign(req, expires)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// sigV4Transport signs requests just before they are sent.
+type sigV4Transport struct {
+	next   http.RoundTripper
+	signer *SigV4Signer
+}
+
+func (t *sigV4Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	signed := req.Clone(req.Context())
+	signed.Body = req.Body
+	if err := t.signer.Sign(signed); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(signed)
+}
+
+// Sign adds the X-Amz-Date, X-Amz-Content-Sha256 and Authorization headers
+// to req. With a streaming payload it also sets Content-Encoding and
+// X-Amz-Decoded-Content-Length and replaces the body with its aws-chunked
+// encoding. An X-Amz-Content-Sha256 header already set on req is used as
+// the hash of a signed payload instead of reading the body.
+func (s *SigV4Signer) Sign(req *http.Request) error {
+	now := s.config.Clock.Now().UTC()
+	creds := s.config.Credentials
+	req.Header.Set("X-Amz-Date", now.Format(sigV4TimeFormat))
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	payloadHash, err := s.payloadHash(req)
+	if err != nil {
+		return err
+	}
+	if s.config.Service == "s3" || payloadHash == sigV4Unsigned || payloadHash == sigV4Streaming {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+	if payloadHash == sigV4Streaming {
+		req.Header.Add("Content-Encoding", "aws-chunked")
+		req.Header.Set("X-Amz-Decoded-Content-Length", strconv.FormatInt(req.ContentLength, 10))
+		req.ContentLength = sigV4StreamLength(req.ContentLength, int64(s.config.ChunkSize))
+	}
+
+	signedHeaders, canonicalHeaders := sigV4Headers(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s.canonicalPath(req.URL),
+		sigV4Query(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := s.scope(now)
+	signature := s.signature(now, scope, canonicalRequest)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, creds.AccessKeyID, scope, signedHeaders, signature))
+
+	if payloadHash == sigV4Streaming {
+		s.streamBody(req, now, scope, signature)
+	}
+	return nil
+}
+
+// Presign returns the URL of req with the signature in its query, valid
+// for expires. Only the host and the headers set on req are signed, the
+// payload is not.
+func (s *SigV4Signer) Presign(req *http.Request, expires time.Duration) (*url.URL, error) {
+	now := s.config.Clock.Now().UTC()
+	creds := s.config.Credentials
+	scope := s.scope(now)
+
+	u := *req.URL
+	signedHeaders, canonicalHeaders := sigV4Headers(req)
+
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", sigV4Algorithm)
+	query.Set("X-Amz-Credential", creds.AccessKeyID+"/"+scope)
+	query.Set("X-Amz-Date", now.Format(sigV4TimeFormat))
+	query.Set("X-Amz-Expires", strconv.FormatInt(int64(expires/time.Second), 10))
+	query.Set("X-Amz-SignedHeaders", signedHeaders)
+	if creds.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	canonicalQuery := sigV4Query(query)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s.canonicalPath(&u),
+		canonicalQuery,
+		canonicalHeaders,
+		signedHeaders,
+		sigV4Unsigned,
+	}, "\n")
+
+	u.RawQuery = canonicalQuery + "&X-Amz-Signature=" + s.signature(now, scope, canonicalRequest)
+	return &u, nil
+}
+
+// payloadHash returns the value of X-Amz-Content-Sha256 for req.
+func (s *SigV4Signer) payloadHash(req *http.Request) (string, error) {
+	hasBody := req.Body != nil && req.Body != http.NoBody
+	switch {
+	case s.config.Payload == SigV4UnsignedPayload:
+		return sigV4Unsigned, nil
+	case s.config.Payload == SigV4StreamingPayload && hasBody:
+		if req.ContentLength <= 0 {
+			return "", errors.New("vortex: SigV4 streaming payloads need a known content length")
+		}
+		return sigV4Streaming, nil
+	case req.Header.Get("X-Amz-Content-Sha256") != "":
+		return req.Header.Get("X-Amz-Content-Sha256"), nil
+	case req.Context().Value(sigV4PayloadKey{}) != nil:
+		return req.Context().Value(sigV4PayloadKey{}).(string), nil
+	case !hasBody:
+		return sha256Hex(nil), nil
+	}
+
+	if req.GetBody == nil {
+		return "", errors.New("vortex: SigV4 cannot hash a body that is not replayable, use an unsigned or streaming payload")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	return sha256Reader(body)
+}
+
+// sigV4PayloadKey carries the payload hash computed by withPayloadHash.
+type sigV4PayloadKey struct{}
+
+// withPayloadHash hashes the prepared request body for Sign before upload
+// progress tracking wraps it, so that hashing is not reported as upload
+// progress. Middleware that replaces such a body invalidates the hash.
+func (s *SigV4Signer) withPayloadHash(req *http.Request, body *requestBody) (*http.Request, error) {
+	if s.config.Payload != SigV4SignedPayload || req.Header.Get("X-Amz-Content-Sha256") != "" {
+		return req, nil
+	}
+
+	var reader io.Reader
+	switch {
+	case body.data != nil:
+		reader = bytes.NewReader(body.data)
+	case req.Body == nil || req.Body == http.NoBody || req.GetBody == nil:
+		return req, nil
+	default:
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		reader = rc
+	}
+
+	hash, err := sha256Reader(reader)
+	if err != nil {
+		return nil, err
+	}
+	return req.WithContext(context.WithValue(req.Context(), sigV4PayloadKey{}, hash)), nil
+}
+
+func (s *SigV4Signer) scope(now time.Time) string {
+	return strings.Join([]string{now.Format(sigV4DateFormat), s.config.Region, s.config.Service, "aws4_request"}, "/")
+}
+
+func (s *SigV4Signer) signature(now time.Time, scope, canonicalRequest string) string {
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		now.Format(sigV4TimeFormat),
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+	return hex.EncodeToString(hmacSHA256(s.signingKey(now), stringToSign))
+}
+
+func (s *SigV4Signer) signingKey(now time.Time) []byte {
+	key := hmacSHA256([]byte("AWS4"+s.config.Credentials.SecretAccessKey), now.Format(sigV4DateFormat))
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, s.config.Service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+// canonicalPath encodes every path segment once for S3 and twice for other
+// services, as SigV4 requires.
+func (s *SigV4Signer) canonicalPath(u *url.URL) string {
+	path := u.Path
+	if path == "" {
+		return "/"
+	}
+	path = sigV4Escape(path, false)
+	if s.config.Service != "s3" {
+		path = sigV4Escape(path, false)
+	}
+	return path
+}
+
+// sigV4Headers returns the signed header list and the canonical headers:
+// host, the content length of a body, and every header on req except the
+// ones proxies may change.
+func sigV4Headers(req *http.Request) (string, string) {
+	headers := map[string][]string{}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers["host"] = []string{host}
+	if req.ContentLength > 0 {
+		headers["content-length"] = []string{strconv.FormatInt(req.ContentLength, 10)}
+	}
+	for key, values := range req.Header {
+		name := strings.ToLower(key)
+		if sigV4IgnoredHeaders[name] {
+			continue
+		}
+		headers[name] = append(headers[name], values...)
+	}
+
+	names := sortedKeys(headers)
+	var canonical strings.Builder
+	for _, name := range names {
+		values := make([]string, len(headers[name]))
+		for i, value := range headers[name] {
+			values[i] = strings.Join(strings.Fields(value), " ")
+		}
+		canonical.WriteString(name + ":" + strings.Join(values, ",") + "\n")
+	}
+	return strings.Join(names, ";"), canonical.String()
+}
+
+// sigV4Query sorts the query by key and value and encodes it strictly.
+func sigV4Query(query url.Values) string {
+	var pairs []string
+	for key, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, sigV4Escape(key, true)+"="+sigV4Escape(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// sigV4Escape percent-encodes everything but the RFC 3986 unreserved
+// characters, and slashes unless encodeSlash is set.
+func sigV4Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !encodeSlash {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// streamBody replaces the body of req with its aws-chunked encoding, each
+// chunk signed with the signature of the previous one.
+func (s *SigV4Signer) streamBody(req *http.Request, now time.Time, scope, seed string) {
+	body := req.Body
+	getBody := req.GetBody
+	newReader := func(body io.ReadCloser) io.ReadCloser {
+		return &sigV4ChunkReader{body: body, signer: s, now: now, scope: scope, previous: seed, chunk: make([]byte, s.config.ChunkSize)}
+	}
+	req.Body = newReader(body)
+	if getBody != nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return newReader(body), nil
+		}
+	}
+}
+
+// sigV4StreamLength is the length of size bytes in aws-chunked encoding.
+func sigV4StreamLength(size, chunkSize int64) int64 {
+	chunkLength := func(n int64) int64 {
+		return int64(len(strconv.FormatInt(n, 16))+len(sigV4ChunkSignature)+sigV4SignatureLength+2) + n + 2
+	}
+	length := size / chunkSize * chunkLength(chunkSize)
+	if rest := size % chunkSize; rest > 0 {
+		length += chunkLength(rest)
+	}
+	return length + chunkLength(0)
+}
+
+type sigV4ChunkReader struct {
+	body     io.ReadCloser
+	signer   *SigV4Signer
+	now      time.Time
+	scope    string
+	previous string
+	chunk    []byte
+	pending  bytes.Buffer
+	done     bool
+}
+
+func (r *sigV4ChunkReader) Read(p []byte) (int, error) {
+	for r.pending.Len() == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(r.body, r.chunk)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		r.writeChunk(r.chunk[:n])
+		if n == 0 {
+			r.done = true
+		}
+	}
+	return r.pending.Read(p)
+}
+
+func (r *sigV4ChunkReader) writeChunk(data []byte) {
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256-PAYLOAD",
+		r.now.Format(sigV4TimeFormat),
+		r.scope,
+		r.previous,
+		sha256Hex(nil),
+		sha256Hex(data),
+	}, "\n")
+	r.previous = hex.EncodeToString(hmacSHA256(r.signer.signingKey(r.now), stringToSign))
+	fmt.Fprintf(&r.pending, "%x%s%s\r\n", len(data), sigV4ChunkSignature, r.previous)
+	r.pending.Write(data)
+	r.pending.WriteString("\r\n")
+}
+
+func (r *sigV4ChunkReader) Close() error {
+	return r.body.Close()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func sha256Reader(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,203 @@
+package vortex
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is one Server-Sent Event.
+type Event struct {
+	// ID is the last event ID seen on the stream, sent back as
+	// Last-Event-ID when reconnecting.
+	ID string
+	// Event is the event type, "message" when the server did not set one.
+	Event string
+	// Data holds the data lines of the event joined by "\n".
+	Data string
+	// Retry is the reconnection time the server set with this event, or 0.
+	Retry time.Duration
+}
+
+// defaultSSERetry is the reconnection time used until the server sends one.
+const defaultSSERetry = 3 * time.Second
+
+// sseHandlerError carries an error returned by the event callback, which
+// stops the stream instead of causing a reconnect.
+type sseHandlerError struct {
+	err error
+}
+
+func (e *sseHandlerError) Error() string {
+	return e.err.Error()
+}
+
+// SSE subscribes to the Server-Sent Events stream at endpoint and calls fn
+// for every event. When the connection drops it reconnects after the retry
+// interval the server asked for, sending Last-Event-ID. It returns when fn
+// returns an error, the context is done, the server answers 204 No Content
+// or a status other than 200, or a response fails VerifyResponses. The total timeout
+// set with Opt.Timeout or SetTimeout does not apply, as it would cut the
+// stream off; SetReadTimeout detects a stalled stream.
+func (r *Request) SSE(endpoint string, fn func(Event) error) error {
+	ctx := r.Context()
+	stream := &sseStream{retry: defaultSSERetry}
+
+	for {
+		req := *r
+		req.timeout = 0
+		req.Headers = r.Headers.Clone()
+		if req.Headers == nil {
+			req.Headers = http.Header{}
+		}
+		req.Headers.Set("Accept", "text/event-stream")
+		req.Headers.Set("Cache-Control", "no-cache")
+		if stream.lastID != "" {
+			req.Headers.Set("Last-Event-ID", stream.lastID)
+		}
+		req.streamHandler = func(resp *http.Response) error {
+			if resp.StatusCode != http.StatusOK {
+				return nil
+			}
+			if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/event-stream" {
+				return &sseHandlerError{err: errors.New("vortex: response is not an event stream: " + resp.Header.Get("Content-Type"))}
+			}
+			return stream.read(resp.Body, fn)
+		}
+
+		resp, err := req.execute(http.MethodGet, endpoint, nil)
+		var handlerErr *sseHandlerError
+		if errors.As(err, &handlerErr) {
+			return handlerErr.err
+		}
+		var signatureErr *SignatureError
+		if errors.As(err, &signatureErr) {
+			return err
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if resp != nil && resp.StatusCode == http.StatusNoContent {
+			return nil
+		}
+		if resp != nil && resp.StatusCode != http.StatusOK {
+			return &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Body: resp.Body}
+		}
+
+		if err := sleep(ctx, r.client.clock, stream.retry); err != nil {
+			return err
+		}
+	}
+}
+
+// SSEChannel runs SSE in a goroutine and delivers its events on a channel.
+// The error channel receives the result of SSE once the events channel is
+// closed. Cancel the request context to stop the stream.
+func (r *Request) SSEChannel(endpoint string) (<-chan Event, <-chan error) {
+	events := make(chan Event)
+	errc := make(chan error, 1)
+	ctx := r.Context()
+
+	go func() {
+		err := r.SSE(endpoint, func(event Event) error {
+			select {
+			case events <- event:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		close(events)
+		errc <- err
+		close(errc)
+	}()
+
+	return events, errc
+}
+
+// SSE subscribes to the Server-Sent Events stream at endpoint.
+func (c *Client) SSE(endpoint string, fn func(Event) error) error {
+	return c.R().SSE(endpoint, fn)
+}
+
+// sseStream holds what survives reconnects: the last event ID and the
+// reconnection time.
+type sseStream struct {
+	lastID string
+	retry  time.Duration
+}
+
+// read parses an event stream as described in the HTML standard and calls
+// fn for every event until the body ends.
+func (s *sseStream) read(body io.Reader, fn func(Event) error) error {
+	reader := bufio.NewReader(body)
+	var data strings.Builder
+	var eventType string
+	var retry time.Duration
+	first := true
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if first {
+			line = strings.TrimPrefix(line, "\ufeff")
+			first = false
+		}
+
+		if line == "" {
+			if data.Len() > 0 {
+				event := Event{
+					ID:    s.lastID,
+					Event: eventType,
+					Data:  strings.TrimSuffix(data.String(), "\n"),
+					Retry: retry,
+				}
+				if event.Event == "" {
+					event.Event = "message"
+				}
+				if err := fn(event); err != nil {
+					return &sseHandlerError{err: err}
+				}
+			}
+			data.Reset()
+			eventType = ""
+			retry = 0
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "event":
+			eventType = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				s.lastID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 63); err == nil {
+				s.retry = time.Duration(ms) * time.Millisecond
+				retry = s.retry
+			}
+		}
+	}
+}
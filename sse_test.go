@@ -0,0 +1,183 @@
+package vortex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errDone = errors.New("done")
+
+func newSSEServer(handler func(w http.ResponseWriter, r *http.Request, connection int)) *httptest.Server {
+	var mu sync.Mutex
+	connections := 0
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		connections++
+		connection := connections
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		handler(w, r, connection)
+	}))
+}
+
+func TestSSEParsesEvents(t *testing.T) {
+	server := newSSEServer(func(w http.ResponseWriter, r *http.Request, connection int) {
+		fmt.Fprint(w, "\ufeff: comment\n\n")
+		fmt.Fprint(w, "data: first\n\n")
+		fmt.Fprint(w, "event: update\nid: 7\ndata: line one\ndata:line two\nretry: 1500\n\n")
+		fmt.Fprint(w, "id: 8\r\ndata: {\"done\": true}\r\n\r\n")
+	})
+	defer server.Close()
+
+	var events []Event
+	err := New(Opt{BaseURL: server.URL}).SSE("/events", func(event Event) error {
+		events = append(events, event)
+		if len(events) == 3 {
+			return errDone
+		}
+		return nil
+	})
+	if !errors.Is(err, errDone) {
+		t.Fatalf("expected the handler error to stop the stream, got %v", err)
+	}
+
+	expected := []Event{
+		{Event: "message", Data: "first"},
+		{ID: "7", Event: "update", Data: "line one\nline two", Retry: 1500 * time.Millisecond},
+		{ID: "8", Event: "message", Data: `{"done": true}`},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %+v", len(expected), events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("expected event %d to be %+v, got %+v", i, expected[i], events[i])
+		}
+	}
+}
+
+func TestSSEReconnects(t *testing.T) {
+	var lastEventIDs []string
+	server := newSSEServer(func(w http.ResponseWriter, r *http.Request, connection int) {
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+		if r.Header.Get("Accept") != "text/event-stream" {
+			t.Errorf("expected Accept text/event-stream, got %s", r.Header.Get("Accept"))
+		}
+		fmt.Fprintf(w, "retry: 250\nid: %d\ndata: connection %d\n\n", connection, connection)
+	})
+	defer server.Close()
+
+	clock := newFakeClock()
+	var data []string
+	err := New(Opt{BaseURL: server.URL}).SetClock(clock).SSE("/events", func(event Event) error {
+		data = append(data, event.Data)
+		if len(data) == 3 {
+			return errDone
+		}
+		return nil
+	})
+	if !errors.Is(err, errDone) {
+		t.Fatalf("expected the handler error to stop the stream, got %v", err)
+	}
+
+	if strings.Join(data, ",") != "connection 1,connection 2,connection 3" {
+		t.Errorf("expected one event per connection, got %v", data)
+	}
+	if strings.Join(lastEventIDs, ",") != ",1,2" {
+		t.Errorf("expected Last-Event-ID to carry the last id, got %q", lastEventIDs)
+	}
+	waits := clock.Waits()
+	if len(waits) != 2 || waits[0] != 250*time.Millisecond {
+		t.Errorf("expected to wait the server retry of 250ms between connections, got %v", waits)
+	}
+}
+
+func TestSSEIgnoresTotalTimeout(t *testing.T) {
+	var connections int32
+	server := newSSEServer(func(w http.ResponseWriter, r *http.Request, connection int) {
+		atomic.StoreInt32(&connections, int32(connection))
+		for i := 1; i <= 4; i++ {
+			fmt.Fprintf(w, "data: %d\n\n", i)
+			w.(http.Flusher).Flush()
+			time.Sleep(30 * time.Millisecond)
+		}
+	})
+	defer server.Close()
+
+	var events int
+	err := New(Opt{BaseURL: server.URL, Timeout: 50 * time.Millisecond}).SSE("/events", func(event Event) error {
+		events++
+		if events == 4 {
+			return errDone
+		}
+		return nil
+	})
+	if !errors.Is(err, errDone) {
+		t.Fatalf("expected the handler error to stop the stream, got %v", err)
+	}
+	if n := atomic.LoadInt32(&connections); n != 1 {
+		t.Errorf("expected the stream to outlive Opt.Timeout on one connection, got %d connections", n)
+	}
+}
+
+func TestSSEStopsOnNoContent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	err := New(Opt{BaseURL: server.URL}).SSE("/events", func(event Event) error {
+		t.Errorf("expected no events, got %+v", event)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("expected 204 to end the stream without error, got %v", err)
+	}
+}
+
+func TestSSEErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	err := New(Opt{BaseURL: server.URL}).SSE("/events", func(event Event) error { return nil })
+	if !errors.Is(err, &HTTPError{StatusCode: http.StatusUnauthorized}) {
+		t.Errorf("expected a 401 HTTPError, got %v", err)
+	}
+}
+
+func TestSSEChannel(t *testing.T) {
+	server := newSSEServer(func(w http.ResponseWriter, r *http.Request, connection int) {
+		fmt.Fprint(w, "data: a\n\ndata: b\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, errc := New(Opt{BaseURL: server.URL}).R().SetContext(ctx).SSEChannel("/events")
+
+	if event := <-events; event.Data != "a" {
+		t.Errorf("expected a, got %+v", event)
+	}
+	if event := <-events; event.Data != "b" {
+		t.Errorf("expected b, got %+v", event)
+	}
+	cancel()
+
+	for range events {
+	}
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
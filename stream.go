@@ -0,0 +1,41 @@
+package vortex
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// Streaming hands the body of 2xx responses to the caller instead of
+// reading it: Response.RawBody is set, Response.Body stays empty and no
+// output is decoded. Other responses are read and decoded as usual.
+func (c *Client) Streaming() *Client {
+	c.streaming = true
+	return c
+}
+
+// Streaming hands the body of a 2xx response to the caller as
+// Response.RawBody, which must be closed. The connection is read only as
+// fast as the caller reads, and cancelling the request context closes it.
+func (r *Request) Streaming() *Request {
+	r.streaming = true
+	return r
+}
+
+// streamBody is a response body handed to the caller. Read errors are
+// reported as transport errors, with the context error when the request
+// context was cancelled.
+type streamBody struct {
+	io.ReadCloser
+	req     *http.Request
+	request *Request
+	ctx     context.Context
+}
+
+func (b *streamBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		err = newTransportError(b.req, contextError(b.ctx, b.request.timeoutError(err)))
+	}
+	return n, err
+}
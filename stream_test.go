@@ -0,0 +1,133 @@
+package vortex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStreaming(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Stream", "yes")
+		fmt.Fprint(w, "first ")
+		w.(http.Flusher).Flush()
+		<-release
+		fmt.Fprint(w, "second")
+	}))
+	defer server.Close()
+
+	var hookStatus int
+	var hookHeader string
+	resp, err := New(Opt{BaseURL: server.URL}).
+		UseHook(func(req *http.Request, resp *http.Response) {
+			hookStatus = resp.StatusCode
+			hookHeader = resp.Header.Get("X-Stream")
+		}).
+		R().
+		Streaming().
+		Get("/stream")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if hookStatus != http.StatusOK || hookHeader != "yes" {
+		t.Errorf("expected hooks to see the status and headers, got %d %q", hookStatus, hookHeader)
+	}
+	if resp.RawBody == nil || len(resp.Body) != 0 {
+		t.Fatalf("expected the body to be handed over unread, got %q", resp.Body)
+	}
+	defer resp.RawBody.Close()
+
+	buf := make([]byte, len("first "))
+	if _, err := io.ReadFull(resp.RawBody, buf); err != nil || string(buf) != "first " {
+		t.Fatalf("expected to read the first chunk before the server sent the rest, got %q, %v", buf, err)
+	}
+	close(release)
+	rest, err := io.ReadAll(resp.RawBody)
+	if err != nil || string(rest) != "second" {
+		t.Errorf("expected the rest of the body, got %q, %v", rest, err)
+	}
+}
+
+func TestStreamingCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "partial")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	resp, err := New(Opt{BaseURL: server.URL}).R().SetContext(ctx).Streaming().Get("/stream")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer resp.RawBody.Close()
+
+	buf := make([]byte, len("partial"))
+	if _, err := io.ReadFull(resp.RawBody, buf); err != nil {
+		t.Fatalf("expected the first chunk, got %v", err)
+	}
+	cancel()
+	_, err = io.ReadAll(resp.RawBody)
+	var transportErr *TransportError
+	if !errors.As(err, &transportErr) || !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a *TransportError wrapping context.Canceled, got %v", err)
+	}
+}
+
+func TestStreamingErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"message":"bad"}`)
+	}))
+	defer server.Close()
+
+	var apiErr struct {
+		Message string `json:"message"`
+	}
+	resp, err := New(Opt{BaseURL: server.URL}).R().
+		Streaming().
+		SetError(&apiErr).
+		Get("/stream")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.RawBody != nil {
+		t.Errorf("expected error responses to be buffered")
+	}
+	if string(resp.Body) != `{"message":"bad"}` || apiErr.Message != "bad" {
+		t.Errorf("expected the error body to be read and decoded, got %q and %+v", resp.Body, apiErr)
+	}
+}
+
+func TestStreamHandlerOwnsBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "streamed")
+	}))
+	defer server.Close()
+
+	var handled string
+	resp, err := New(Opt{BaseURL: server.URL}).R().
+		Stream(func(resp *http.Response) error {
+			body, err := io.ReadAll(resp.Body)
+			handled = string(body)
+			return err
+		}).
+		Get("/stream")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if handled != "streamed" {
+		t.Errorf("expected the handler to read the whole body, got %q", handled)
+	}
+	if len(resp.Body) != 0 || resp.RawBody != nil {
+		t.Errorf("expected the response body to stay empty, got %q", resp.Body)
+	}
+}
@@ -0,0 +1,106 @@
+package vortex
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Timeouts configures the phases of a connection. A zero field leaves the
+// transport default in place. The total time of a request is set with
+// Opt.Timeout, or per request with SetTimeout.
+type Timeouts struct {
+	// Dial limits establishing the TCP connection.
+	Dial time.Duration
+	// TLSHandshake limits the TLS handshake.
+	TLSHandshake time.Duration
+	// ResponseHeader limits waiting for the response headers once the
+	// request has been written.
+	ResponseHeader time.Duration
+	// IdleConn is how long an idle keep-alive connection stays open.
+	IdleConn time.Duration
+}
+
+// SetTimeouts configures the dial, TLS handshake, response header and idle
+// connection timeouts of the client transport.
+func (c *Client) SetTimeouts(timeouts Timeouts) *Client {
+	c.timeouts = timeouts
+	transport := c.transport()
+	if timeouts.Dial > 0 {
+		transport.DialContext = (&net.Dialer{
+			Timeout:   timeouts.Dial,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+	}
+	if timeouts.TLSHandshake > 0 {
+		transport.TLSHandshakeTimeout = timeouts.TLSHandshake
+	}
+	if timeouts.ResponseHeader > 0 {
+		transport.ResponseHeaderTimeout = timeouts.ResponseHeader
+	}
+	if timeouts.IdleConn > 0 {
+		transport.IdleConnTimeout = timeouts.IdleConn
+	}
+	return c
+}
+
+// SetTimeout limits the total time of the request, including reading the
+// body, overriding Opt.Timeout. 0 disables the limit, which long-running
+// streams need.
+func (r *Request) SetTimeout(d time.Duration) *Request {
+	r.timeout = d
+	return r
+}
+
+// transport returns the *http.Transport of the client, installing a copy of
+// http.DefaultTransport when none is set.
+func (c *Client) transport() *http.Transport {
+	if transport, ok := c.httpClient.Transport.(*http.Transport); ok {
+		return transport
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	c.httpClient.Transport = transport
+	return transport
+}
+
+// timeoutError reports which configured timeout caused err as a
+// *TimeoutError. Other errors, including an expired request context, are
+// returned unchanged.
+func (r *Request) timeoutError(err error) error {
+	var timeout interface{ Timeout() bool }
+	if err == nil || r.Context().Err() != nil || !errors.As(err, &timeout) || !timeout.Timeout() {
+		return err
+	}
+	var timeoutErr *TimeoutError
+	if errors.As(err, &timeoutErr) {
+		return err
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+
+	timeouts := r.client.timeouts
+	var opErr *net.OpError
+	switch message := err.Error(); {
+	case strings.Contains(message, "Client.Timeout"):
+		return &TimeoutError{Phase: "total", Duration: r.timeout, Err: err}
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return &TimeoutError{Phase: "dial", Duration: timeouts.Dial, Err: err}
+	case strings.Contains(message, "TLS handshake timeout"):
+		return &TimeoutError{Phase: "tls_handshake", Duration: r.client.tlsHandshakeTimeout(), Err: err}
+	case strings.Contains(message, "timeout awaiting response headers"):
+		return &TimeoutError{Phase: "response_header", Duration: timeouts.ResponseHeader, Err: err}
+	}
+	return err
+}
+
+func (c *Client) tlsHandshakeTimeout() time.Duration {
+	if transport, ok := c.httpClient.Transport.(*http.Transport); ok {
+		return transport.TLSHandshakeTimeout
+	}
+	return http.DefaultTransport.(*http.Transport).TLSHandshakeTimeout
+}
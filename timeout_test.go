@@ -0,0 +1,132 @@
+package vortex
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func assertTimeoutPhase(t *testing.T, err error, phase string) {
+	t.Helper()
+	var transportErr *TransportError
+	if !errors.As(err, &transportErr) || !transportErr.Timeout() {
+		t.Fatalf("expected a *TransportError reporting a timeout, got %v", err)
+	}
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Phase != phase {
+		t.Fatalf("expected a %s *TimeoutError, got %v", phase, err)
+	}
+}
+
+func TestResponseHeaderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	_, err := New(Opt{BaseURL: server.URL}).
+		SetTimeouts(Timeouts{ResponseHeader: 20 * time.Millisecond}).
+		Get("/")
+	assertTimeoutPhase(t, err, "response_header")
+}
+
+func TestTLSHandshakeTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	_, err = New(Opt{BaseURL: "https://" + listener.Addr().String()}).
+		SetTimeouts(Timeouts{TLSHandshake: 20 * time.Millisecond}).
+		Get("/")
+	assertTimeoutPhase(t, err, "tls_handshake")
+}
+
+func TestDialTimeoutPhase(t *testing.T) {
+	client := New(Opt{}).SetTimeouts(Timeouts{Dial: time.Second})
+	err := client.R().timeoutError(&net.OpError{Op: "dial", Net: "tcp", Err: &TimeoutError{Phase: "dial"}})
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("expected an existing *TimeoutError to be kept, got %v", err)
+	}
+
+	err = client.R().timeoutError(&net.OpError{Op: "dial", Net: "tcp", Err: timeoutNetError{}})
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Phase != "dial" || timeoutErr.Duration != time.Second {
+		t.Errorf("expected a dial *TimeoutError of 1s, got %v", err)
+	}
+}
+
+func TestDialTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// The listener never accepts, and the deadline passes before the
+	// dialer gets to connect, so the dial itself times out.
+	client := New(Opt{BaseURL: "http://" + listener.Addr().String()}).SetTimeouts(Timeouts{Dial: time.Nanosecond})
+	_, err = client.Get("/")
+	assertTimeoutPhase(t, err, "dial")
+	var timeoutErr *TimeoutError
+	if errors.As(err, &timeoutErr) && timeoutErr.Duration != time.Nanosecond {
+		t.Errorf("expected the configured dial timeout, got %s", timeoutErr.Duration)
+	}
+
+	err = New(Opt{}).R().timeoutError(&net.OpError{Op: "dial", Net: "tcp", Err: timeoutNetError{}})
+	if !errors.As(err, &timeoutErr) || timeoutErr.Duration != 0 || err.Error() != "vortex: dial timeout expired" {
+		t.Errorf("expected a dial timeout without a duration when none is configured, got %v", err)
+	}
+}
+
+type timeoutNetError struct{}
+
+func (timeoutNetError) Error() string   { return "i/o timeout" }
+func (timeoutNetError) Timeout() bool   { return true }
+func (timeoutNetError) Temporary() bool { return true }
+
+func TestRequestTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 4; i++ {
+			fmt.Fprint(w, "chunk ")
+			w.(http.Flusher).Flush()
+			time.Sleep(30 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	client := New(Opt{BaseURL: server.URL, Timeout: 50 * time.Millisecond})
+	_, err := client.Get("/")
+	assertTimeoutPhase(t, err, "total")
+
+	resp, err := client.R().SetTimeout(0).Streaming().Get("/")
+	if err != nil {
+		t.Fatalf("expected no error without a total timeout, got %v", err)
+	}
+	defer resp.RawBody.Close()
+	body, err := io.ReadAll(resp.RawBody)
+	if err != nil || len(body) != len("chunk ")*4 {
+		t.Errorf("expected the whole stream, got %q, %v", body, err)
+	}
+	if client.httpClient.Timeout != 50*time.Millisecond {
+		t.Errorf("expected the client timeout to be left alone, got %v", client.httpClient.Timeout)
+	}
+}